@@ -0,0 +1,71 @@
+package insiderci
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+// Baseline lists previously triaged vulnerabilities, identified by their
+// Fingerprint, which no longer fail the analysis.
+type Baseline struct {
+	Vulnerabilities []BaselineEntry `json:"vulnerabilities"`
+}
+
+// BaselineEntry keeps the VulID, class and method next to the fingerprint so
+// the file can be reviewed by humans.
+type BaselineEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	VulID       string `json:"vulId,omitempty"`
+	Class       string `json:"class,omitempty"`
+	Method      string `json:"method,omitempty"`
+}
+
+func NewBaseline(sast *Sast) *Baseline {
+	b := &Baseline{Vulnerabilities: []BaselineEntry{}}
+	seen := make(map[string]bool)
+	for _, v := range sast.SastVulnerabilities {
+		fingerprint := v.Fingerprint()
+		if seen[fingerprint] {
+			continue
+		}
+		seen[fingerprint] = true
+		b.Vulnerabilities = append(b.Vulnerabilities, BaselineEntry{
+			Fingerprint: fingerprint,
+			VulID:       v.VulID,
+			Class:       v.Class,
+			Method:      v.Method,
+		})
+	}
+	return b
+}
+
+func LoadBaseline(filename string) (*Baseline, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (b *Baseline) Save(filename string) error {
+	data, err := json.MarshalIndent(b, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// Apply marks the vulnerabilities of sast found in the baseline as Baselined.
+func (b *Baseline) Apply(sast *Sast) {
+	fingerprints := make(map[string]bool, len(b.Vulnerabilities))
+	for _, entry := range b.Vulnerabilities {
+		fingerprints[entry.Fingerprint] = true
+	}
+	for i, v := range sast.SastVulnerabilities {
+		sast.SastVulnerabilities[i].Baselined = fingerprints[v.Fingerprint()]
+	}
+}
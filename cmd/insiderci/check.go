@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+// runCheck validates the flags, the config file, the credentials and the
+// targets as scan would, and warns about settings that are likely mistakes.
+// Nothing is uploaded.
+func runCheck(args []string, out io.Writer) int {
+	return run(args, out, true)
+}
+
+// checkPolicy warns about gating settings that are valid but unlikely to be
+// what was meant.
+func checkPolicy(out io.Writer, policy insiderci.Policy, apiKey string) {
+	gated := len(policy.FailOn) > 0 || policy.MinCVSS > 0 || len(policy.MaxCounts) > 0
+	switch {
+	case *noFailFlag:
+		fmt.Fprintf(out, "Warning: -no-fail is set, the pipeline never fails on findings\n")
+	case policy.FailOnAny:
+	case policy.Score == 100 && policy.ScoreOperator != insiderci.ScoreGreaterOrEqual:
+		fmt.Fprintf(out, "Warning: -score 100 with -score-operator %s fails every analysis finding vulnerabilities, use -score-operator %s or a lower -score\n",
+			insiderci.ScoreGreater, insiderci.ScoreGreaterOrEqual)
+	case policy.Score == 0 && !gated:
+		fmt.Fprintf(out, "Warning: no -score, -fail-on, -min-cvss or -max-<rank> is set, any vulnerability fails the pipeline\n")
+	}
+	if !*waitFlag {
+		fmt.Fprintf(out, "Warning: -wait=false only uploads, the results are neither saved nor gated\n")
+	}
+	if *tokenFlag != "" || os.Getenv(tokenEnv) != "" || apiKey != "" {
+		fmt.Fprintf(out, "Warning: a token or API key is only verified by the upload, it may have expired\n")
+	}
+}
+
+// checkTarget validates the credentials and the target, as dryRun does when
+// -dry-run is also set. The component itself can only be checked by an
+// upload.
+func (r *runner) checkTarget(ctx context.Context, target string, info os.FileInfo, component int) int {
+	if *dryRunFlag {
+		if code := r.dryRun(ctx, target, info, component); code != 0 {
+			return code
+		}
+		fmt.Fprintf(r.stdout, "Check passed for %s, component %d\n", target, component)
+		return 0
+	}
+	if _, err := insiderci.New(ctx, *emailFlag, *passwordFlag, target, component, r.opts...); err != nil {
+		printError(r.out, err)
+		return 1
+	}
+
+	if !info.IsDir() {
+		fmt.Fprintf(r.stdout, "Check passed for %s, %s, component %d\n", target, insiderci.FormatSize(info.Size()), component)
+		return 0
+	}
+	files, _, size, ok := r.measure(target, nil)
+	if !ok {
+		return 1
+	}
+	fmt.Fprintf(r.stdout, "Check passed for %s, %d files, %s zipped, component %d\n", target, files, insiderci.FormatSize(size), component)
+	return 0
+}
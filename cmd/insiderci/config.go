@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultConfig = ".insiderci.yaml"
+
+// configFile returns the -config file or, when the target is a directory
+// holding a .insiderci.yaml, that file. An empty name means no config.
+func configFile(args []string) string {
+	if *configFlag != "" || len(args) < 1 {
+		return *configFlag
+	}
+	name := filepath.Join(args[0], defaultConfig)
+	if info, err := os.Stat(name); err == nil && info.Mode().IsRegular() {
+		return name
+	}
+	return ""
+}
+
+// applyConfig sets the flags named by the keys of the config file, except the
+// ones given on the command line, which take precedence. Lists are joined with
+// commas, unless the flag is repeatable.
+func applyConfig(fs *flag.FlagSet, filename string) error {
+	values, err := loadConfig(filename)
+	if err != nil {
+		return err
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	for _, kv := range values {
+		if kv.key == "config" || fs.Lookup(kv.key) == nil {
+			return fmt.Errorf("%s: unknown key %q", filename, kv.key)
+		}
+		if explicit[kv.key] {
+			continue
+		}
+		values := kv.values
+		if _, repeatable := fs.Lookup(kv.key).Value.(*stringsFlag); !repeatable {
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, value := range values {
+			if err := fs.Set(kv.key, value); err != nil {
+				return fmt.Errorf("%s: invalid value %q for %s: %w", filename, value, kv.key, err)
+			}
+		}
+	}
+	return nil
+}
+
+type configValue struct {
+	key    string
+	values []string
+}
+
+// loadConfig reads a JSON file, by its .json extension, or a flat YAML file of
+// "key: value" pairs where lists are written as [a, b] or as "- item" lines.
+func loadConfig(filename string) ([]configValue, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		return parseJSONConfig(filename, data)
+	}
+	return parseYAMLConfig(filename, data)
+}
+
+func parseJSONConfig(filename string, data []byte) ([]configValue, error) {
+	var object map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var values []configValue
+	for _, key := range keys {
+		value := object[key]
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		kv := configValue{key: key}
+		for _, item := range items {
+			switch item := item.(type) {
+			case string:
+				kv.values = append(kv.values, item)
+			case json.Number:
+				kv.values = append(kv.values, item.String())
+			case bool:
+				kv.values = append(kv.values, strconv.FormatBool(item))
+			default:
+				return nil, fmt.Errorf("%s: unsupported value for %q", filename, key)
+			}
+		}
+		values = append(values, kv)
+	}
+	return values, nil
+}
+
+func parseYAMLConfig(filename string, data []byte) ([]configValue, error) {
+	var values []configValue
+	seen := make(map[string]bool)
+	inList := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if !inList || trimmed == line {
+				return nil, fmt.Errorf("%s:%d: list item without a key", filename, n)
+			}
+			item, err := yamlScalar(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", filename, n, err)
+			}
+			values[len(values)-1].values = append(values[len(values)-1].values, item)
+			continue
+		}
+
+		if trimmed != line {
+			return nil, fmt.Errorf("%s:%d: nested keys are not supported", filename, n)
+		}
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			return nil, fmt.Errorf("%s:%d: expected \"key: value\"", filename, n)
+		}
+		key := strings.TrimSpace(line[:colon])
+		if seen[key] {
+			return nil, fmt.Errorf("%s:%d: duplicate key %q", filename, n, key)
+		}
+		seen[key] = true
+
+		kv := configValue{key: key}
+		value := strings.TrimSpace(line[colon+1:])
+		inList = value == ""
+		switch {
+		case inList:
+		case strings.HasPrefix(value, "["):
+			if !strings.HasSuffix(value, "]") {
+				return nil, fmt.Errorf("%s:%d: unterminated list", filename, n)
+			}
+			inner := strings.TrimSpace(value[1 : len(value)-1])
+			if inner != "" {
+				for _, item := range strings.Split(inner, ",") {
+					item, err := yamlScalar(strings.TrimSpace(item))
+					if err != nil {
+						return nil, fmt.Errorf("%s:%d: %w", filename, n, err)
+					}
+					kv.values = append(kv.values, item)
+				}
+			}
+		default:
+			item, err := yamlScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", filename, n, err)
+			}
+			kv.values = []string{item}
+		}
+		values = append(values, kv)
+	}
+	return values, scanner.Err()
+}
+
+// yamlScalar unquotes a single or double quoted value and strips the trailing
+// comment of a plain one.
+func yamlScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := strings.LastIndex(value, `"`)
+		if end == 0 || !yamlComment(value[end+1:]) {
+			return "", fmt.Errorf("invalid quoted value %s", value)
+		}
+		return strconv.Unquote(value[:end+1])
+	case strings.HasPrefix(value, "'"):
+		end := strings.LastIndex(value, "'")
+		if end == 0 || !yamlComment(value[end+1:]) {
+			return "", fmt.Errorf("invalid quoted value %s", value)
+		}
+		return strings.Replace(value[1:end], "''", "'", -1), nil
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
+
+func yamlComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || strings.HasPrefix(s, "#")
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+var csvHeader = []string{"Cvss", "Rank", "Class", "Method", "VulID", "ShortMessage", "LongMessage", "File"}
+
+func saveCSV(filename string, sast *insiderci.Sast) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, v := range sast.SastVulnerabilities {
+		record := []string{v.Cvss, v.Rank, v.Class, v.Method, v.VulID, v.ShortMessage, v.LongMessage, v.Location()}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
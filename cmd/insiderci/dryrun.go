@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+// dryRun validates the credentials and lists what would be uploaded for the
+// target, without starting an analysis.
+func (r *runner) dryRun(ctx context.Context, target string, info os.FileInfo, component int) int {
+	if _, err := insiderci.New(ctx, *emailFlag, *passwordFlag, target, component, r.opts...); err != nil {
+		printError(r.out, err)
+		return 1
+	}
+
+	if !info.IsDir() {
+		fmt.Fprintf(r.stdout, "Dry run: would upload %s, %s, for component %d\n", target, insiderci.FormatSize(info.Size()), component)
+		return 0
+	}
+
+	files, total, size, ok := r.measure(target, r.stdout)
+	if !ok {
+		return 1
+	}
+	fmt.Fprintf(r.stdout, "Dry run: would upload %d files, %s, %s zipped, for component %d\n",
+		files, insiderci.FormatSize(total), insiderci.FormatSize(size), component)
+	return 0
+}
+
+// measure counts the files of the directory target that would be uploaded,
+// their size and the size of their zip, listing them on list when not nil.
+// Errors are printed and reported as false.
+func (r *runner) measure(target string, list io.Writer) (files int, total, zipped int64, ok bool) {
+	err := insiderci.WalkDirectory(target, func(name string, info os.FileInfo) error {
+		files++
+		total += info.Size()
+		if list != nil {
+			fmt.Fprintf(list, "%s\t%s\n", name, insiderci.FormatSize(info.Size()))
+		}
+		return nil
+	}, r.opts...)
+	var size countWriter
+	if err == nil {
+		err = insiderci.ZipTo(&size, target, r.opts...)
+	}
+	if errors.Is(err, insiderci.ErrEmptyDirectory) {
+		fmt.Fprintf(r.out, "Error: target '%s' has no files to analyze\n", target)
+		return 0, 0, 0, false
+	}
+	if err != nil {
+		printZipError(r.out, target, err)
+		return 0, 0, 0, false
+	}
+	return files, total, int64(size), true
+}
+
+// countWriter counts the bytes written to it.
+type countWriter int64
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	*c += countWriter(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+const gitlabReportVersion = "14.1.2"
+
+type gitlabReport struct {
+	Version         string                `json:"version"`
+	Vulnerabilities []gitlabVulnerability `json:"vulnerabilities"`
+	Scan            gitlabScan            `json:"scan"`
+}
+
+type gitlabVulnerability struct {
+	ID          string             `json:"id"`
+	Category    string             `json:"category"`
+	Name        string             `json:"name"`
+	Message     string             `json:"message"`
+	Description string             `json:"description"`
+	CVE         string             `json:"cve"`
+	Severity    string             `json:"severity"`
+	Scanner     gitlabScanner      `json:"scanner"`
+	Location    gitlabLocation     `json:"location"`
+	Identifiers []gitlabIdentifier `json:"identifiers"`
+}
+
+type gitlabScanner struct {
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Version string        `json:"version,omitempty"`
+	Vendor  *gitlabVendor `json:"vendor,omitempty"`
+}
+
+type gitlabVendor struct {
+	Name string `json:"name"`
+}
+
+type gitlabLocation struct {
+	File      string `json:"file"`
+	StartLine int    `json:"start_line,omitempty"`
+	Class     string `json:"class,omitempty"`
+	Method    string `json:"method,omitempty"`
+}
+
+type gitlabIdentifier struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type gitlabScan struct {
+	Scanner   gitlabScanner `json:"scanner"`
+	Type      string        `json:"type"`
+	StartTime string        `json:"start_time"`
+	EndTime   string        `json:"end_time"`
+	Status    string        `json:"status"`
+}
+
+func saveGitlabSast(filename string, sast *insiderci.Sast, started time.Time) error {
+	b, err := json.MarshalIndent(toGitlabSast(sast, started, time.Now()), "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, b, 0644)
+}
+
+func toGitlabSast(sast *insiderci.Sast, started, finished time.Time) gitlabReport {
+	const timeFormat = "2006-01-02T15:04:05"
+
+	scanner := gitlabScanner{ID: "insiderci", Name: "Insider"}
+	report := gitlabReport{
+		Version:         gitlabReportVersion,
+		Vulnerabilities: []gitlabVulnerability{},
+		Scan: gitlabScan{
+			Scanner: gitlabScanner{
+				ID:      scanner.ID,
+				Name:    scanner.Name,
+				Version: version,
+				Vendor:  &gitlabVendor{Name: "Insider"},
+			},
+			Type:      "sast",
+			StartTime: started.UTC().Format(timeFormat),
+			EndTime:   finished.UTC().Format(timeFormat),
+			Status:    "success",
+		},
+	}
+
+	// The fingerprint leaves out the line, so it tracks a vulnerability across
+	// commits but is not unique within a report: the id adds the line, and a
+	// count for the same vulnerability repeated on a line.
+	ids := make(map[string]int)
+	for _, v := range sast.SastVulnerabilities {
+		file := v.File()
+		fingerprint := v.Fingerprint()
+		id := fingerprint + ":" + strconv.Itoa(v.Line)
+		ids[id]++
+		if n := ids[id]; n > 1 {
+			id += ":" + strconv.Itoa(n)
+		}
+		report.Vulnerabilities = append(report.Vulnerabilities, gitlabVulnerability{
+			ID:          id,
+			Category:    "sast",
+			Name:        v.ShortMessage,
+			Message:     v.ShortMessage,
+			Description: v.LongMessage,
+			CVE:         fingerprint,
+			Severity:    gitlabSeverity(v.Rank),
+			Scanner:     scanner,
+			Location: gitlabLocation{
+				File:      file,
+				StartLine: v.Line,
+				Class:     v.Class,
+				Method:    v.Method,
+			},
+			Identifiers: gitlabIdentifiers(v, fingerprint),
+		})
+	}
+	return report
+}
+
+func gitlabSeverity(rank string) string {
+	switch insiderci.NormalizeRank(rank) {
+	case insiderci.RankCritical:
+		return "Critical"
+	case insiderci.RankHigh:
+		return "High"
+	case insiderci.RankMedium:
+		return "Medium"
+	case insiderci.RankLow:
+		return "Low"
+	case insiderci.RankInfo:
+		return "Info"
+	default:
+		return "Unknown"
+	}
+}
+
+func gitlabIdentifiers(v insiderci.SastVulnerability, fingerprint string) []gitlabIdentifier {
+	identifiers := []gitlabIdentifier{
+		{Type: "insider", Name: "Insider " + v.VulID, Value: v.VulID},
+		{Type: "insider_fingerprint", Name: "Insider fingerprint " + fingerprint[:8], Value: fingerprint},
+	}
+	if cwe := strings.TrimPrefix(strings.ToUpper(v.Cwe), "CWE-"); cwe != "" {
+		identifiers = append(identifiers, gitlabIdentifier{Type: "cwe", Name: "CWE-" + cwe, Value: cwe})
+	}
+	return identifiers
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+func TestGitlabUniqueIDs(t *testing.T) {
+	v := insiderci.SastVulnerability{VulID: "a", Class: "src/db.go", Method: "query", ShortMessage: "SQL injection", Line: 10}
+	moved := v
+	moved.Line = 20
+	sast := &insiderci.Sast{SastVulnerabilities: []insiderci.SastVulnerability{v, moved, v}}
+
+	ids := make(map[string]bool)
+	for n, vulnerability := range toGitlabSast(sast, time.Time{}, time.Time{}).Vulnerabilities {
+		if ids[vulnerability.ID] {
+			t.Errorf("vulnerabilities[%d]: id %s repeated", n, vulnerability.ID)
+		}
+		ids[vulnerability.ID] = true
+		if vulnerability.CVE != v.Fingerprint() {
+			t.Errorf("vulnerabilities[%d]: cve = %s, want the fingerprint %s", n, vulnerability.CVE, v.Fingerprint())
+		}
+		tracked := false
+		for _, identifier := range vulnerability.Identifiers {
+			tracked = tracked || identifier.Value == v.Fingerprint()
+		}
+		if !tracked {
+			t.Errorf("vulnerabilities[%d]: fingerprint missing from the identifiers", n)
+		}
+	}
+}
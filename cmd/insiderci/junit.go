@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// saveJunit writes one testcase per vulnerability, grouped in a testsuite per
+// class. Vulnerabilities ranked at least minRank are reported as failures;
+// an empty minRank reports every vulnerability as a failure.
+func saveJunit(filename string, sast *insiderci.Sast, minRank string) error {
+	b, err := xml.MarshalIndent(toJunit(sast, minRank), "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append([]byte(xml.Header), b...), 0644)
+}
+
+func toJunit(sast *insiderci.Sast, minRank string) junitTestSuites {
+	suites := junitTestSuites{Name: "insiderci"}
+	index := make(map[string]int)
+
+	for _, v := range sast.SastVulnerabilities {
+		i, ok := index[v.Class]
+		if !ok {
+			i = len(suites.Suites)
+			index[v.Class] = i
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: v.Class})
+		}
+
+		details := fmt.Sprintf("CVSS: %s\nRank: %s\nFile: %s\n\n%s", v.Cvss, v.Rank, v.Location(), v.LongMessage)
+		testcase := junitTestCase{
+			Name:      fmt.Sprintf("%s [%s]", v.Method, v.VulID),
+			Classname: v.Class,
+		}
+		if v.Baselined {
+			testcase.Skipped = &junitSkipped{Message: "baselined"}
+			testcase.SystemOut = details
+			suites.Suites[i].Skipped++
+			suites.Skipped++
+		} else if minRank == "" || insiderci.Severity(v.Rank) >= insiderci.Severity(minRank) {
+			testcase.Failure = &junitFailure{
+				Message: v.ShortMessage,
+				Type:    strings.ToLower(v.Rank),
+				Text:    details,
+			}
+			suites.Suites[i].Failures++
+			suites.Failures++
+		} else {
+			testcase.SystemOut = details
+		}
+		suites.Suites[i].Cases = append(suites.Suites[i].Cases, testcase)
+		suites.Suites[i].Tests++
+		suites.Tests++
+	}
+	return suites
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jsonLogger writes every event as a JSON object on its own line, with the
+// time, the message and the key/value pairs of the event. Durations are
+// written in seconds.
+type jsonLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+	// types, when set, replaces the level and message of each event with a
+	// type field, named after the message, as in the ndjson output.
+	types map[string]string
+}
+
+// ndjsonTypes names the events of -output ndjson.
+var ndjsonTypes = map[string]string{
+	"authenticated":         "auth_ok",
+	"authentication failed": "auth_failed",
+	"upload started":        "upload_started",
+	"upload finished":       "upload_done",
+	"upload failed":         "upload_failed",
+	"analysis status":       "poll",
+	"analysis finished":     "analysis_done",
+	"analysis failed":       "analysis_failed",
+	"result":                "result",
+	"decision":              "decision",
+}
+
+func (l *jsonLogger) Info(msg string, args ...interface{}) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	writeField(&b, "time", time.Now().Format(time.RFC3339Nano))
+	b.WriteByte(',')
+	if l.types != nil {
+		kind, ok := l.types[msg]
+		if !ok {
+			kind = strings.Replace(msg, " ", "_", -1)
+		}
+		writeField(&b, "type", kind)
+	} else {
+		writeField(&b, "level", "INFO")
+		b.WriteByte(',')
+		writeField(&b, "msg", msg)
+	}
+	for n := 0; n+1 < len(args); n += 2 {
+		b.WriteByte(',')
+		writeField(&b, fmt.Sprint(args[n]), args[n+1])
+	}
+	b.WriteString("}\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(b.Bytes())
+}
+
+func writeField(b *bytes.Buffer, key string, value interface{}) {
+	if d, ok := value.(time.Duration); ok {
+		value = d.Seconds()
+	}
+	k, _ := json.Marshal(key)
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	b.Write(k)
+	b.WriteByte(':')
+	b.Write(v)
+}
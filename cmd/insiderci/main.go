@@ -2,14 +2,27 @@ package main
 
 import (
 	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"html/template"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"text/template"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"gitlab.inlabs.app/cyber/insiderci"
 )
@@ -18,126 +31,1147 @@ var (
 	version string
 )
 
+const (
+	tokenEnv  = "INSIDER_TOKEN"
+	apiKeyEnv = "INSIDER_API_KEY"
+)
+
 const (
 	usageText = `
 insiderci is a utility that can be used on CI mats to perform tests on the Insider platform.
 
+Usage:
+  insiderci scan [flags] <directory or zip>...
+  insiderci report [flags] <result.json>
+  insiderci check [flags] <directory or zip>...
+  insiderci version
+
 `
 )
 
 var (
-	emailFlag     = flag.String("email", "", "Insider email")
-	passwordFlag  = flag.String("password", "", "Insider password")
-	noFailFlag    = flag.Bool("no-fail", false, "Do not fail analysis, even if issues were found")
-	scoreFlag     = flag.Int("score", 0, "Score to fail pipeline")
-	componentFlag = flag.Int("component", 0, "Component ID")
-	saveFlag      = flag.Bool("save", false, "Save results on file in json and html format")
-	versionFlag   = flag.Bool("version", false, "Print version")
+	emailFlag           = flag.String("email", "", "Insider email (default $INSIDER_EMAIL)")
+	passwordFlag        = flag.String("password", "", "Insider password (default $INSIDER_PASSWORD)")
+	tokenFlag           = flag.String("token", "", "Token of a previous login, skips email and password (default $INSIDER_TOKEN)")
+	apiKeyFlag          = flag.String("api-key", "", "Personal access token of the Insider account, skips email and password (default $INSIDER_API_KEY)")
+	printTokenFlag      = flag.Bool("print-token", false, "Login, print the token to stdout and exit")
+	branchFlag          = flag.String("branch", "", "Branch of the code, kept in the saved results (default detected from the CI variables)")
+	commitFlag          = flag.String("commit", "", "Commit of the code, kept in the saved results (default detected from the CI variables)")
+	tagFlag             = flag.String("tag", "", "Tag of the code, kept in the saved results (default detected from the CI variables)")
+	noFailFlag          = flag.Bool("no-fail", false, "Do not fail analysis, even if issues were found")
+	scoreFlag           = flag.Int("score", 0, "Minimum security score, 0 to 100 with higher being better, to pass the pipeline: lower scores fail it, see -score-operator")
+	scoreOperatorFlag   = flag.String("score-operator", insiderci.ScoreGreater, "How the score must compare to -score to pass: gt (strictly greater) or gte (greater or equal)")
+	requireScoreFlag    = flag.Bool("require-score", false, "Fail the pipeline when the results have no security score, instead of treating it as 0")
+	failOnAnyFlag       = flag.Bool("fail-on-any", false, "Fail the pipeline on any vulnerability, baselined or not, whatever its rank or the score")
+	failOnFlag          = flag.String("fail-on", "", "Comma separated vulnerability ranks that fail the pipeline, e.g. critical,high")
+	maxCriticalFlag     = flag.Int("max-critical", -1, "Fail the pipeline on more critical vulnerabilities than this, -1 for no limit")
+	maxHighFlag         = flag.Int("max-high", -1, "Fail the pipeline on more high vulnerabilities than this, -1 for no limit")
+	maxMediumFlag       = flag.Int("max-medium", -1, "Fail the pipeline on more medium vulnerabilities than this, -1 for no limit")
+	maxLowFlag          = flag.Int("max-low", -1, "Fail the pipeline on more low vulnerabilities than this, -1 for no limit")
+	maxInfoFlag         = flag.Int("max-info", -1, "Fail the pipeline on more info vulnerabilities than this, -1 for no limit")
+	minCVSSFlag         = flag.Float64("min-cvss", 0, "Fail the pipeline on vulnerabilities with a CVSS score of at least this value, e.g. 7.0")
+	dedupKeyFlag        = flag.String("dedup-key", insiderci.DefaultDedupKey, "Comma separated fields identifying duplicated vulnerabilities (vulid, class, method, line, cwe, rank, message), empty to keep duplicates")
+	baselineFlag        = flag.String("baseline", "", "JSON file with fingerprints of accepted vulnerabilities, which do not fail the pipeline")
+	writeBaselineFlag   = flag.Bool("write-baseline", false, "Write every vulnerability found to the -baseline file")
+	compareFlag         = flag.String("compare", "", "Previous result JSON, from -save, to report added and removed vulnerabilities against")
+	compareGateFlag     = flag.Bool("compare-gate", false, "Only fail the pipeline on vulnerabilities added since -compare")
+	configFlag          = flag.String("config", "", "Config file, YAML or JSON, with default flag values (default .insiderci.yaml in the target directory)")
+	debugFlag           = flag.Bool("debug", false, "Log every HTTP request with its status code and duration, Authorization header redacted")
+	logJSONFlag         = flag.Bool("log-json", false, "Log the login, upload, status checks and pass/fail decision as JSON lines, with durations in seconds")
+	outputFlag          = flag.String("output", "text", "Format of stdout: text, or ndjson for one JSON event per line (auth_ok, upload_done, poll, result, decision, ...) instead of the results")
+	jsonFlag            = flag.Bool("json", false, "Print the results as JSON to stdout instead of the text results, then printed to stderr")
+	quietFlag           = flag.Bool("quiet", false, "Only print errors, results are still saved and gate the exit code")
+	timingsFlag         = flag.Bool("timings", false, "Print how long the zip, upload, scan and download of the results took")
+	noColorFlag         = flag.Bool("no-color", false, "Do not color the ranks of the results printed to a terminal (default $NO_COLOR)")
+	widthFlag           = flag.Int("width", 0, "Width of the separators of the results printed (default $COLUMNS or the width of the terminal, 80 otherwise)")
+	noDRAFlag           = flag.Bool("no-dra", false, "Leave the DRA (Data Risk Analytics) out of the printed results and the html report, it is still saved in the json")
+	topFilesFlag        = flag.Int("top-files", 0, "Print the N files with the highest risk, the sum of the CVSS of their vulnerabilities, also listed in the html report")
+	listRulesFlag       = flag.String("list-rules", "", "Print the distinct rules (VulID) and classes found, with their counts, as text or json, e.g. to write -only-class and -ignore-class filters")
+	groupByFlag         = flag.String("group-by", "", "Group the vulnerabilities printed and of -markdown by class, file or rule")
+	saveFlag            = flag.Bool("save", false, "Save results on file in json and html format")
+	outputNameFlag      = flag.String("output-name", defaultOutputName, "Name of the files of -save, without extension; {component}, {branch}, {commit} and {timestamp} are filled from the run and the CI variables")
+	outputDirFlag       = flag.String("output-dir", "", "Directory, created if needed, where -save writes its files (default current directory)")
+	templateFlag        = flag.String("template", "", "Go template file for the html report of -save (default built-in report)")
+	cdnCSSFlag          = flag.Bool("cdn-css", false, "Download Bootstrap from its CDN to style.css instead of embedding the style in the html report")
+	redactPathsFlag     = flag.String("redact-paths", "", "Replace the directories of the files in every output by a hash, writing to the given JSON file the mapping to reverse it")
+	rawFlag             = flag.String("raw", "", "Save the results response of the Insider API, as received, on the given file")
+	sarifFlag           = flag.String("sarif", "", "Save results on the given file in SARIF 2.1.0 format")
+	junitFlag           = flag.String("junit", "", "Save results on the given file in JUnit XML format")
+	junitRankFlag       = flag.String("junit-rank", "", "Minimum rank reported as a JUnit failure (default every vulnerability)")
+	gitlabSastFlag      = flag.String("gitlab-sast", "", "Save results on the given file in GitLab SAST report format")
+	csvFlag             = flag.String("csv", "", "Save vulnerabilities on the given file in CSV format")
+	markdownFlag        = flag.String("markdown", "", "Save results on the given file in markdown, for pull request comments")
+	markdownLimitFlag   = flag.Int("markdown-limit", 1000, "Maximum length of each vulnerability description in the markdown report, 0 for no limit")
+	summaryFlag         = flag.String("summary", "", "Save the score, the counts by rank and the pass/fail decision on the given file in JSON, without the vulnerabilities")
+	webhookFlag         = flag.String("webhook", "", "URL to POST a JSON summary of the results to, e.g. a Slack or Teams incoming webhook")
+	webhookTimeoutFlag  = flag.Duration("webhook-timeout", 10*time.Second, "Timeout of each -webhook attempt")
+	webhookRequiredFlag = flag.Bool("webhook-required", false, "Fail the run when -webhook can't be delivered, instead of only warning")
+	versionFlag         = flag.Bool("version", false, "Print version")
+	apiURLFlag          = flag.String("api-url", "", "Base URL of a self-hosted Insider API (default Insider SaaS)")
+	maxRetriesFlag      = flag.Int("max-retries", 3, "Maximum number of retries of a request failing with a server or network error, or rate limited")
+	uploadRetriesFlag   = flag.Int("upload-retries", -1, "Maximum number of retries of the upload of a file, from its start, on a server or network error (default -max-retries)")
+	retryDelayFlag      = flag.Duration("retry-delay", time.Second, "Base delay between retries, doubled on every attempt")
+	pollIntervalFlag    = flag.Duration("poll-interval", time.Second, "Interval between checks of the analysis status")
+	timeoutFlag         = flag.Duration("timeout", 0, "Maximum duration of the whole analysis, e.g. 30m (default no timeout)")
+	proxyFlag           = flag.String("proxy", "", "Proxy URL for every request, overriding HTTP_PROXY/HTTPS_PROXY/NO_PROXY")
+	caCertFlag          = flag.String("ca-cert", "", "PEM file with the CA certificates of a self-hosted Insider, trusted along with the system ones")
+	clientCertFlag      = flag.String("client-cert", "", "PEM file with the client certificate for mutual TLS, with -client-key")
+	clientKeyFlag       = flag.String("client-key", "", "PEM file with the private key of -client-cert")
+	insecureFlag        = flag.Bool("insecure", false, "Skip the verification of the TLS certificate of the Insider API. Unsafe, only for testing")
+	streamFlag          = flag.Bool("stream", false, "Stream the zip of a directory into the upload instead of writing a temporary file")
+	dryRunFlag          = flag.Bool("dry-run", false, "Log in and list the files that would be uploaded, without starting an analysis")
+	analysisIDFlag      = flag.Int("analysis-id", 0, "Collect the results of an analysis started by a previous run, printed as \"Analysis N started\", instead of uploading the target again")
+	waitFlag            = flag.Bool("wait", true, "Wait for the analysis to finish; with -wait=false only upload, print the analysis ID to stdout and exit without gating")
+	parallelFlag        = flag.Int("parallel", 1, "Maximum number of targets analyzed at the same time")
+	maxSizeFlag         = flag.String("max-size", "", "Maximum size of the uploaded archive, e.g. 500MB (default no limit)")
+	compressionFlag     = flag.String("compression", "default", "Compression of the zip of a directory: store, fast, default or best")
+	followSymlinksFlag  = flag.Bool("follow-symlinks", false, "Zip the targets of symbolic links inside the directory, which are skipped by default")
+	skipHiddenFlag      = flag.Bool("skip-hidden", false, "Leave the hidden files and directories of a directory, such as .github or .idea, out of the zip")
+	keepZipFlag         = flag.Bool("keep-zip", false, "Keep the zip created from a directory after the run, for debugging")
+	changedFilesFlag    = flag.String("changed-files-from", "", "File with the only files of the directory to upload, one per line relative to it, e.g. the output of git diff --name-only")
+	excludeFileFlag     = flag.String("exclude-file", "", "File with one -exclude pattern per line, # comments and blank lines ignored")
+	excludeFlag         stringsFlag
+	onlyClassFlag       stringsFlag
+	ignoreClassFlag     stringsFlag
+	componentFlag       componentsFlag
 )
 
+func init() {
+	flag.Var(&onlyClassFlag, "only-class", "Only report and gate on vulnerabilities whose class matches this name or glob (repeatable)")
+	flag.Var(&ignoreClassFlag, "ignore-class", "Leave out of reports and gating the vulnerabilities whose class matches this name or glob (repeatable)")
+	flag.Var(&excludeFlag, "exclude", "Glob pattern, relative to the directory root, of paths to leave out of the zip (repeatable)")
+	flag.Var(&componentFlag, "component", "Component ID (required), repeatable or comma separated to pair one component with each target, in order")
+}
+
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// readPatterns reads one pattern per line of file, skipping blank lines and
+// lines starting with #.
+func readPatterns(file string) ([]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, nil
+}
+
+type componentsFlag []int
+
+func (c *componentsFlag) String() string {
+	ids := make([]string, len(*c))
+	for i, id := range *c {
+		ids[i] = strconv.Itoa(id)
+	}
+	return strings.Join(ids, ",")
+}
+
+func (c *componentsFlag) Set(value string) error {
+	for _, id := range strings.Split(value, ",") {
+		component, err := strconv.Atoi(strings.TrimSpace(id))
+		if err != nil || component <= 0 {
+			return fmt.Errorf("invalid component %q, expected a positive ID", id)
+		}
+		*c = append(*c, component)
+	}
+	return nil
+}
+
 func usage() {
 	fmt.Fprintf(os.Stderr, usageText)
 	flag.PrintDefaults()
 }
 
+// Exit codes, so that pipelines can tell a run that could not complete from
+// one that found vulnerabilities failing the policy.
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitFindings = 2
+	// exitInterrupted is the code of a run cancelled by SIGINT or SIGTERM, as
+	// shells report processes killed by SIGINT.
+	exitInterrupted = 130
+)
+
 func main() {
 	flag.Usage = usage
-	flag.Parse()
-	os.Exit(run(flag.Args(), os.Stderr))
+	// Invalid flags are usage errors, not findings, so they must not exit
+	// with the status 2 of flag.ExitOnError.
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+
+	command, args := "", os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "scan", "report", "check", "version":
+			command, args = args[0], args[1:]
+		}
+	}
+	if err := flag.CommandLine.Parse(args); err == flag.ErrHelp {
+		os.Exit(exitOK)
+	} else if err != nil {
+		os.Exit(exitError)
+	}
+
+	switch command {
+	case "scan":
+		os.Exit(run(flag.Args(), os.Stderr, false))
+	case "report":
+		os.Exit(runReport(flag.Args(), os.Stderr))
+	case "check":
+		os.Exit(runCheck(flag.Args(), os.Stderr))
+	case "version":
+		fmt.Printf("insiderci version %s\n", version)
+	default:
+		// Flags without a command are kept for compatibility, as scan.
+		if !*versionFlag {
+			fmt.Fprintf(os.Stderr, "Warning: running without a command is deprecated and will be removed in the next release, use insiderci scan\n")
+		}
+		os.Exit(run(flag.Args(), os.Stderr, false))
+	}
 }
 
-func run(args []string, out io.Writer) int {
+// run analyzes the targets, or only validates them and the settings with
+// check.
+func run(args []string, out io.Writer, check bool) int {
 	if *versionFlag {
 		fmt.Fprintf(out, "insiderci version %s", version)
 		return 0
 	}
 
-	if len(args) < 1 {
+	if len(args) < 1 && *analysisIDFlag > 0 {
+		// The target is not uploaded again; only its config file is used.
+		args = []string{"."}
+	}
+	if len(args) < 1 && !*printTokenFlag {
 		flag.Usage()
 		return 1
 	}
 
-	filename := args[0]
-	insider, err := insiderci.New(*emailFlag, *passwordFlag, filename, *componentFlag)
+	if config := configFile(args); config != "" {
+		if err := applyConfig(flag.CommandLine, config); err != nil {
+			fmt.Fprintf(out, "Error to load config: %v\n", err)
+			return 1
+		}
+	}
+
+	progress := out
+	if *quietFlag {
+		progress = ioutil.Discard
+	}
+
+	opts := []insiderci.Option{
+		insiderci.WithRetry(*maxRetriesFlag, *retryDelayFlag),
+		insiderci.WithUploadRetry(*uploadRetriesFlag),
+		insiderci.WithPollInterval(*pollIntervalFlag),
+		insiderci.WithProgress(progress),
+	}
+	if *debugFlag {
+		opts = append(opts, insiderci.WithDebug(out))
+	}
+	var events insiderci.Logger
+	switch {
+	case *outputFlag != "text" && *outputFlag != "ndjson":
+		fmt.Fprintf(out, "Error: invalid -output %q: must be text or ndjson\n", *outputFlag)
+		return 1
+	case *outputFlag == "ndjson" && *jsonFlag:
+		fmt.Fprintf(out, "Error: -json and -output ndjson can't be used together\n")
+		return 1
+	case *outputFlag == "ndjson" && *logJSONFlag:
+		fmt.Fprintf(out, "Error: -log-json and -output ndjson can't be used together\n")
+		return 1
+	case *outputFlag == "ndjson":
+		events = &jsonLogger{w: os.Stdout, types: ndjsonTypes}
+	case *logJSONFlag:
+		events = &jsonLogger{w: out}
+	}
+	if events != nil {
+		opts = append(opts, insiderci.WithLogger(events))
+	}
+	if *apiURLFlag != "" {
+		opts = append(opts, insiderci.WithAPIURL(*apiURLFlag))
+	}
+	if token := *tokenFlag; token != "" || os.Getenv(tokenEnv) != "" {
+		if token == "" {
+			token = os.Getenv(tokenEnv)
+		}
+		opts = append(opts, insiderci.WithToken(token))
+	}
+	apiKey := *apiKeyFlag
+	if apiKey == "" {
+		apiKey = os.Getenv(apiKeyEnv)
+	}
+	if apiKey != "" {
+		opts = append(opts, insiderci.WithAPIKey(apiKey))
+	}
+
+	client, proxy, err := proxyClient()
 	if err != nil {
 		fmt.Fprintf(out, "Error: %v\n", err)
 		return 1
 	}
+	if proxy != nil {
+		opts = append(opts, insiderci.WithProxy(proxy))
+	}
 
-	sast, err := insider.Start()
+	tlsConf, err := tlsConfig()
 	if err != nil {
 		fmt.Fprintf(out, "Error: %v\n", err)
 		return 1
 	}
+	if *insecureFlag {
+		fmt.Fprintf(out, "WARNING: -insecure skips TLS certificate verification; the connection to the Insider API is not secure, use it only for testing\n")
+	}
+	if tlsConf != nil {
+		opts = append(opts, insiderci.WithTLSConfig(tlsConf))
+	}
 
-	resumeSast(os.Stdout, sast)
+	failOn, err := insiderci.ParseRanks(*failOnFlag)
+	if err != nil {
+		fmt.Fprintf(out, "Error: invalid -fail-on: %v\n", err)
+		return 1
+	}
+	policy := insiderci.Policy{
+		Score:         *scoreFlag,
+		ScoreOperator: *scoreOperatorFlag,
+		FailOn:        failOn,
+		MinCVSS:       *minCVSSFlag,
+		RequireScore:  *requireScoreFlag,
+		FailOnAny:     *failOnAnyFlag,
+	}
+	for rank, max := range map[string]int{
+		insiderci.RankCritical: *maxCriticalFlag,
+		insiderci.RankHigh:     *maxHighFlag,
+		insiderci.RankMedium:   *maxMediumFlag,
+		insiderci.RankLow:      *maxLowFlag,
+		insiderci.RankInfo:     *maxInfoFlag,
+	} {
+		if max < 0 {
+			continue
+		}
+		if policy.MaxCounts == nil {
+			policy.MaxCounts = make(map[string]int)
+		}
+		policy.MaxCounts[rank] = max
+	}
+	if err := policy.Validate(); err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return 1
+	}
 
-	if *saveFlag {
-		if err := saveSast(*componentFlag, sast); err != nil {
-			fmt.Fprintf(out, "Error to save results: %v\n", err)
+	var dedupKey func(v insiderci.SastVulnerability) string
+	if *dedupKeyFlag != "" {
+		if dedupKey, err = insiderci.ParseDedupKey(*dedupKeyFlag); err != nil {
+			fmt.Fprintf(out, "Error: invalid -dedup-key: %v\n", err)
 			return 1
 		}
 	}
 
-	if !*noFailFlag {
-		if len(sast.SastVulnerabilities) > 0 {
-			if *scoreFlag == 0 {
-				return 1
-			}
-			if *scoreFlag >= sast.SecurityScore {
-				fmt.Fprintf(out, "Score %d lower than %d\n", sast.SecurityScore, *scoreFlag)
+	if *writeBaselineFlag && *baselineFlag == "" {
+		fmt.Fprintf(out, "Error: -write-baseline requires -baseline\n")
+		return 1
+	}
+	if *compareGateFlag && *compareFlag == "" {
+		fmt.Fprintf(out, "Error: -compare-gate requires -compare\n")
+		return 1
+	}
+
+	if *junitRankFlag != "" {
+		ranks, err := insiderci.ParseRanks(*junitRankFlag)
+		if err == nil && len(ranks) != 1 {
+			err = fmt.Errorf("expected a single rank")
+		}
+		if err != nil {
+			fmt.Fprintf(out, "Error: invalid -junit-rank: %v\n", err)
+			return 1
+		}
+	}
+
+	report, err := loadReportTemplate(*templateFlag)
+	if err != nil {
+		fmt.Fprintf(out, "Error to load template: %v\n", err)
+		return 1
+	}
+
+	var maxSize int64
+	if *maxSizeFlag != "" {
+		if maxSize, err = parseSize(*maxSizeFlag); err != nil {
+			fmt.Fprintf(out, "Error: invalid -max-size: %v\n", err)
+			return 1
+		}
+		opts = append(opts, insiderci.WithMaxSize(maxSize))
+	}
+
+	level, ok := compressions[*compressionFlag]
+	if !ok {
+		fmt.Fprintf(out, "Error: invalid -compression %q: must be store, fast, default or best\n", *compressionFlag)
+		return 1
+	}
+	excludes := []string(excludeFlag)
+	if *excludeFileFlag != "" {
+		patterns, err := readPatterns(*excludeFileFlag)
+		if err != nil {
+			fmt.Fprintf(out, "Error: invalid -exclude-file: %v\n", err)
+			return 1
+		}
+		excludes = append(patterns, excludes...)
+	}
+	opts = append(opts, insiderci.WithCompression(level), insiderci.WithExclude(excludes...))
+	if *followSymlinksFlag {
+		opts = append(opts, insiderci.WithFollowSymlinks())
+	}
+	if *skipHiddenFlag {
+		opts = append(opts, insiderci.WithSkipHidden())
+	}
+	if *changedFilesFlag != "" {
+		files, err := readPatterns(*changedFilesFlag)
+		if err != nil {
+			fmt.Fprintf(out, "Error: invalid -changed-files-from: %v\n", err)
+			return 1
+		}
+		opts = append(opts, insiderci.WithFiles(files...))
+	}
+
+	if *redactPathsFlag != "" && *rawFlag != "" {
+		fmt.Fprintf(out, "Error: -raw can't be redacted, it is saved as received\n")
+		return 1
+	}
+	if *listRulesFlag != "" && *listRulesFlag != "text" && *listRulesFlag != "json" {
+		fmt.Fprintf(out, "Error: invalid -list-rules %q: must be text or json\n", *listRulesFlag)
+		return 1
+	}
+	if *topFilesFlag < 0 {
+		fmt.Fprintf(out, "Error: -top-files can't be negative\n")
+		return 1
+	}
+	if *widthFlag < 0 {
+		fmt.Fprintf(out, "Error: -width can't be negative\n")
+		return 1
+	}
+	if *parallelFlag < 1 {
+		fmt.Fprintf(out, "Error: -parallel must be at least 1\n")
+		return 1
+	}
+
+	if err := insiderci.ValidatePatterns(excludes); err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return 1
+	}
+	if _, err := outputName(*outputNameFlag, 0, time.Now()); err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return 1
+	}
+	if *groupByFlag != "" {
+		if _, err := insiderci.GroupVulnerabilities(nil, *groupByFlag); err != nil {
+			fmt.Fprintf(out, "Error: invalid -group-by: %v\n", err)
+			return 1
+		}
+	}
+	classFilter := insiderci.ClassFilter{Only: onlyClassFlag, Ignore: ignoreClassFlag}
+	if err := classFilter.Validate(); err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return 1
+	}
+
+	// A signal cancels the requests in flight, so that the temporary zips are
+	// removed before exiting. The analysis itself can't be cancelled on the
+	// backend. A second signal kills the process.
+	interrupted, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			fmt.Fprintf(out, "Received %v, cancelling the run\n", sig)
+			cancel()
+		case <-interrupted.Done():
+		}
+	}()
+
+	ctx := interrupted
+	if *timeoutFlag > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeoutFlag)
+		defer cancel()
+	}
+
+	components := []int(componentFlag)
+	if len(components) == 0 {
+		components = []int{0}
+	}
+
+	if *printTokenFlag {
+		if apiKey != "" {
+			fmt.Fprintf(out, "Error: -print-token needs -email and -password, an API key is already a token\n")
+			return 1
+		}
+		insider, err := insiderci.New(ctx, *emailFlag, *passwordFlag, "", components[0], opts...)
+		if err != nil {
+			printError(out, err)
+			return 1
+		}
+		fmt.Println(insider.Token())
+		return 0
+	}
+
+	if *analysisIDFlag > 0 && !*waitFlag {
+		fmt.Fprintf(out, "Error: -analysis-id collects the results of an analysis, it can't be used with -wait=false\n")
+		return 1
+	}
+	if *analysisIDFlag > 0 && len(args) > 1 {
+		fmt.Fprintf(out, "Error: -analysis-id collects the results of a single analysis, got %d targets\n", len(args))
+		return 1
+	}
+	if len(componentFlag) == 0 {
+		fmt.Fprintf(out, "Error: -component is required\n")
+		return 1
+	}
+	if len(components) != len(args) {
+		fmt.Fprintf(out, "Error: expected one -component per target, got %d for %d targets\n", len(components), len(args))
+		return 1
+	}
+
+	if check {
+		checkPolicy(out, policy, apiKey)
+	}
+
+	if len(args) > 1 && apiKey == "" {
+		// Log in once, before zipping, and reuse the token for every target.
+		insider, err := insiderci.New(ctx, *emailFlag, *passwordFlag, "", components[0], opts...)
+		if err != nil {
+			printError(out, err)
+			return 1
+		}
+		opts = append(opts, insiderci.WithToken(insider.Token()))
+	}
+
+	r := &runner{
+		out:      out,
+		stdout:   os.Stdout,
+		progress: progress,
+		client:   client,
+		opts:     opts,
+		policy:   policy,
+		dedupKey: dedupKey,
+		report:   report,
+		maxSize:  maxSize,
+		classes:  classFilter,
+		events:   events,
+		multiple: len(args) > 1,
+		check:    check,
+	}
+	text := r.stdout
+	if *jsonFlag {
+		text = out
+	}
+	r.width, r.color = outputWidth(text), useColor(text)
+	codes := make([]int, len(args))
+	if *parallelFlag <= 1 {
+		for i, target := range args {
+			codes[i] = r.analyze(ctx, target, components[i])
+		}
+	} else {
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		slots := make(chan struct{}, *parallelFlag)
+		for i, target := range args {
+			wg.Add(1)
+			go func(i int, target string) {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+
+				// Each analysis writes to its own buffers, flushed as a whole
+				// once it is done, so concurrent outputs are not interleaved.
+				var stdout, stderr bytes.Buffer
+				codes[i] = r.buffered(&stdout, &stderr).analyze(ctx, target, components[i])
+
+				mu.Lock()
+				defer mu.Unlock()
+				io.Copy(r.stdout, &stdout)
+				io.Copy(r.out, &stderr)
+			}(i, target)
+		}
+		wg.Wait()
+	}
+
+	if interrupted.Err() != nil {
+		return exitInterrupted
+	}
+	// A target that could not be analyzed takes precedence over findings.
+	result := exitOK
+	for _, code := range codes {
+		if code == exitError || (code != exitOK && result == exitOK) {
+			result = code
+		}
+	}
+	return result
+}
+
+// proxyClient returns the client of the requests outside of the Insider API,
+// such as -webhook, and the -proxy it goes through, if any.
+func proxyClient() (*http.Client, *url.URL, error) {
+	if *proxyFlag == "" {
+		return http.DefaultClient, nil, nil
+	}
+	proxy, err := url.Parse(*proxyFlag)
+	if err == nil && proxy.Host == "" {
+		err = fmt.Errorf("missing host")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid -proxy %q: %v", *proxyFlag, err)
+	}
+	return &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxy)}}, proxy, nil
+}
+
+// runner holds the settings shared by the analysis of every target.
+type runner struct {
+	out      io.Writer
+	stdout   io.Writer
+	progress io.Writer
+	client   *http.Client
+	opts     []insiderci.Option
+	policy   insiderci.Policy
+	dedupKey func(v insiderci.SastVulnerability) string
+	report   *template.Template
+	maxSize  int64
+	classes  insiderci.ClassFilter
+	// events receives the pass/fail decision of each target, when set.
+	events insiderci.Logger
+	// multiple is set when several targets are analyzed, so that the files
+	// given in flags are suffixed with the component ID.
+	multiple bool
+	// check validates each target instead of analyzing it.
+	check bool
+	// width and color are the width of the results printed and whether
+	// their ranks are colored, set before they are buffered by -parallel.
+	width int
+	color bool
+}
+
+// buffered returns a copy of r writing its results to stdout and its errors
+// and progress to out.
+func (r *runner) buffered(stdout, out io.Writer) *runner {
+	c := *r
+	c.stdout, c.out = stdout, out
+	if c.progress != ioutil.Discard {
+		c.progress = out
+	}
+	c.opts = append(r.opts[:len(r.opts):len(r.opts)], insiderci.WithProgress(c.progress))
+	if *debugFlag {
+		c.opts = append(c.opts, insiderci.WithDebug(out))
+	}
+	return &c
+}
+
+// file returns name, or name with the component ID before its extension
+// when several targets are analyzed.
+func (r *runner) file(name string, component int) string {
+	if !r.multiple || name == "" {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), component, ext)
+}
+
+// analyze uploads and analyzes one target, saves its results and returns its
+// exit code.
+func (r *runner) analyze(ctx context.Context, filename string, component int) int {
+	if r.multiple {
+		fmt.Fprintf(r.progress, "Analyzing %s as component %d\n", filename, component)
+	}
+
+	var err error
+	var baseline *insiderci.Baseline
+	baselineFile := r.file(*baselineFlag, component)
+	if baselineFile != "" && !*writeBaselineFlag {
+		if baseline, err = insiderci.LoadBaseline(baselineFile); err != nil {
+			fmt.Fprintf(r.out, "Error to load baseline: %v\n", err)
+			return 1
+		}
+	}
+
+	var previous *insiderci.Sast
+	if compareFile := r.file(*compareFlag, component); compareFile != "" {
+		if previous, err = insiderci.LoadSast(compareFile); err != nil {
+			fmt.Fprintf(r.out, "Error to load previous result: %v\n", err)
+			return 1
+		}
+	}
+
+	started := time.Now()
+	var sast *insiderci.Sast
+	var code int
+	if *analysisIDFlag > 0 && !r.check {
+		sast, code = r.resume(ctx, component, *analysisIDFlag)
+	} else {
+		sast, code = r.upload(ctx, filename, component)
+	}
+	if sast == nil {
+		return code
+	}
+
+	sast.Metadata = runMetadata()
+	if r.dedupKey != nil {
+		sast.SastVulnerabilities = insiderci.Deduplicate(sast.SastVulnerabilities, r.dedupKey)
+	}
+	if n := r.classes.Apply(sast); n > 0 {
+		fmt.Fprintf(r.progress, "%d vulnerabilities left out by -only-class/-ignore-class\n", n)
+	}
+	insiderci.SortVulnerabilities(sast.SastVulnerabilities)
+	if *writeBaselineFlag {
+		baseline = insiderci.NewBaseline(sast)
+		if err := baseline.Save(baselineFile); err != nil {
+			fmt.Fprintf(r.out, "Error to save baseline: %v\n", err)
+			return 1
+		}
+	}
+	if baseline != nil {
+		baseline.Apply(sast)
+	}
+	var diff *insiderci.Diff
+	if previous != nil {
+		diff = insiderci.Compare(previous, sast)
+	}
+	// Redacted after the baseline and the comparison, which match the real
+	// paths.
+	if code := r.redact(sast, diff, component); code != 0 {
+		return code
+	}
+	if *listRulesFlag != "" {
+		// With -json or -output ndjson, stdout only holds their JSON.
+		list := r.stdout
+		if *jsonFlag || *outputFlag == "ndjson" {
+			list = r.out
+		}
+		if err := listRules(list, sast.SastVulnerabilities, *listRulesFlag); err != nil {
+			fmt.Fprintf(r.out, "Error to list rules: %v\n", err)
+			return 1
+		}
+	}
+
+	if r.events != nil {
+		s := insiderci.Summarize(sast, r.policy)
+		r.events.Info("result", "component", component, "score", s.Score, "counts", s.Counts, "total", s.Total, "baselined", s.Baselined, "filtered", s.Filtered)
+	}
+	if !*quietFlag && *outputFlag == "text" {
+		// With -json, stdout only holds the JSON, to be piped.
+		text := r.stdout
+		if *jsonFlag {
+			text = r.out
+		}
+		resumeSast(text, sast, diff, *groupByFlag, *topFilesFlag, *timingsFlag, r.width, r.color)
+		line := insiderci.Summarize(sast, r.policy).Line()
+		if r.multiple {
+			line = fmt.Sprintf("component=%d %s", component, line)
+		}
+		fmt.Fprintf(text, "insiderci: %s\n", line)
+	}
+	if *jsonFlag {
+		data, err := insiderci.MarshalResult(sast)
+		if err != nil {
+			fmt.Fprintf(r.out, "Error to print json: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(r.stdout, "%s\n", data)
+	}
+
+	if code := r.save(sast, diff, component, started); code != 0 {
+		return code
+	}
+
+	gated := sast
+	if *compareGateFlag {
+		added := *sast
+		added.SastVulnerabilities = diff.Added
+		gated = &added
+	}
+	summary := insiderci.Summarize(gated, r.policy)
+	decided := summary
+	decided.Failed = summary.Failed && !*noFailFlag
+	if *summaryFlag != "" {
+		if err := saveSummary(r.file(*summaryFlag, component), sast, component, decided); err != nil {
+			fmt.Fprintf(r.out, "Error to save summary: %v\n", err)
+			return 1
+		}
+	}
+	if *webhookFlag != "" {
+		if err := notify(ctx, r.client, *webhookFlag, *webhookTimeoutFlag, component, decided); err != nil {
+			if *webhookRequiredFlag {
+				fmt.Fprintf(r.out, "Error to send webhook: %v\n", err)
 				return 1
 			}
+			fmt.Fprintf(r.out, "Warning: failed to send webhook: %v\n", err)
+		}
+	}
+	if r.events != nil {
+		r.events.Info("decision", "component", component, "failed", decided.Failed, "score", summary.Score, "total", summary.Total, "reason", summary.Reason)
+	}
+	if !*noFailFlag && summary.Failed {
+		if r.multiple {
+			fmt.Fprintf(r.out, "Component %d: %s\n", component, summary.Reason)
+		} else {
+			fmt.Fprintln(r.out, summary.Reason)
+		}
+		return exitFindings
+	}
+	return 0
+}
+
+// save writes the results files selected by the flags and returns the exit
+// code of the run.
+func (r *runner) save(sast *insiderci.Sast, diff *insiderci.Diff, component int, started time.Time) int {
+	if *saveFlag {
+		name, _ := outputName(*outputNameFlag, component, started)
+		if !strings.Contains(*outputNameFlag, "{component}") {
+			name = r.file(name, component)
+		}
+		if err := saveSast(r.client, r.report, *outputDirFlag, name, sast, r.out); err != nil {
+			fmt.Fprintf(r.out, "Error to save results: %v\n", err)
+			return 1
+		}
+	}
+
+	if *rawFlag != "" {
+		if err := ioutil.WriteFile(r.file(*rawFlag, component), sast.Raw, 0644); err != nil {
+			fmt.Fprintf(r.out, "Error to save raw results: %v\n", err)
+			return 1
+		}
+	}
+
+	if *sarifFlag != "" {
+		if err := saveSarif(r.file(*sarifFlag, component), sast, diff); err != nil {
+			fmt.Fprintf(r.out, "Error to save sarif: %v\n", err)
+			return 1
+		}
+	}
+
+	if *junitFlag != "" {
+		if err := saveJunit(r.file(*junitFlag, component), sast, *junitRankFlag); err != nil {
+			fmt.Fprintf(r.out, "Error to save junit: %v\n", err)
+			return 1
+		}
+	}
+
+	if *gitlabSastFlag != "" {
+		if err := saveGitlabSast(r.file(*gitlabSastFlag, component), sast, started); err != nil {
+			fmt.Fprintf(r.out, "Error to save gitlab sast report: %v\n", err)
+			return 1
+		}
+	}
+
+	if *csvFlag != "" {
+		if err := saveCSV(r.file(*csvFlag, component), sast); err != nil {
+			fmt.Fprintf(r.out, "Error to save csv: %v\n", err)
+			return 1
+		}
+	}
+
+	if *markdownFlag != "" {
+		if err := saveMarkdown(r.file(*markdownFlag, component), sast, diff, *markdownLimitFlag, *groupByFlag); err != nil {
+			fmt.Fprintf(r.out, "Error to save markdown: %v\n", err)
+			return 1
 		}
 	}
 	return 0
 }
 
-func zipDir(dir string) (string, error) {
-	zipOut, err := os.OpenFile(fmt.Sprintf("%s.zip", dir), os.O_CREATE|os.O_WRONLY, 0666)
+// redact hashes the directories of sast and diff with -redact-paths, and
+// writes the mapping to the real directories to its file.
+func (r *runner) redact(sast *insiderci.Sast, diff *insiderci.Diff, component int) int {
+	if *redactPathsFlag == "" {
+		return 0
+	}
+	redactor := insiderci.NewRedactor()
+	redactor.Sast(sast)
+	if diff != nil {
+		redactor.Vulnerabilities(diff.Added)
+		redactor.Vulnerabilities(diff.Removed)
+		redactor.Vulnerabilities(diff.Unchanged)
+	}
+	data, err := json.MarshalIndent(redactor.Mapping(), "", "\t")
+	if err == nil {
+		err = ioutil.WriteFile(r.file(*redactPathsFlag, component), data, 0644)
+	}
 	if err != nil {
-		return "", err
+		fmt.Fprintf(r.out, "Error to save redacted paths: %v\n", err)
+		return 1
 	}
-	defer zipOut.Close()
+	return 0
+}
 
-	writer := zip.NewWriter(zipOut)
-	defer writer.Close()
+// upload zips and uploads the target and returns the results of its analysis,
+// or nil with the exit code of the run.
+func (r *runner) upload(ctx context.Context, filename string, component int) (*insiderci.Sast, int) {
+	opts := r.opts[:len(r.opts):len(r.opts)]
 
-	err = filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	// The zip is only written after New has validated the credentials, so
+	// wrong credentials fail before the expensive part of the run.
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(r.out, "Error: target '%s' does not exist\n", filename)
+		return nil, 1
+	}
+	if err != nil {
+		fmt.Fprintf(r.out, "Error: %v\n", err)
+		return nil, 1
+	}
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		fmt.Fprintf(r.out, "Error: target '%s' is not a directory\n", filename)
+		return nil, 1
+	}
+
+	if !info.IsDir() {
+		// Files are uploaded as they are, zip/apk/ipa/jar being zip archives.
+		if err := validateArchive(filename); err != nil {
+			fmt.Fprintf(r.out, "Error: target '%s' is not a directory or a zip archive: %v\n", filename, err)
+			return nil, 1
 		}
-		if info.IsDir() {
-			return nil
+		if r.maxSize > 0 && info.Size() > r.maxSize {
+			fmt.Fprintf(r.out, "Error: %v\n", &insiderci.SizeError{Size: info.Size(), Limit: r.maxSize})
+			return nil, 1
 		}
+	}
 
-		f, err := os.Open(file)
-		if err != nil {
-			return err
+	if r.check {
+		return nil, r.checkTarget(ctx, filename, info, component)
+	}
+	if *dryRunFlag {
+		return nil, r.dryRun(ctx, filename, info, component)
+	}
+
+	var dir string
+	var zipOut *os.File
+	if info.IsDir() {
+		dir = filename
+		if *streamFlag {
+			abs, err := filepath.Abs(dir)
+			if err != nil {
+				fmt.Fprintf(r.out, "Error: %v\n", err)
+				return nil, 1
+			}
+			filename = fmt.Sprintf("%s.zip", filepath.Base(abs))
+			opts = append(opts, insiderci.WithPackageStream(func(w io.Writer) error {
+				return insiderci.ZipTo(w, dir, opts...)
+			}))
+		} else {
+			if zipOut, err = tempZip(dir); err != nil {
+				fmt.Fprintf(r.out, "Error to zip %s: %v\n", dir, err)
+				return nil, 1
+			}
+			defer zipOut.Close()
+			filename = zipOut.Name()
+			if *keepZipFlag {
+				fmt.Fprintf(r.progress, "Keeping zip %s\n", filename)
+			} else {
+				defer os.Remove(filename)
+			}
+		}
+	}
+
+	insider, err := insiderci.New(ctx, *emailFlag, *passwordFlag, filename, component, opts...)
+	if err != nil {
+		printError(r.out, err)
+		return nil, 1
+	}
+
+	var zipped time.Duration
+	if zipOut != nil {
+		zipStarted := time.Now()
+		err := insiderci.ZipTo(zipOut, dir, opts...)
+		zipped = time.Since(zipStarted)
+		if err == nil {
+			err = zipOut.Close()
+		}
+		if errors.Is(err, insiderci.ErrEmptyDirectory) {
+			fmt.Fprintf(r.out, "Error: target '%s' has no files to analyze\n", dir)
+			return nil, 1
 		}
-		path, err := filepath.Rel(dir, file)
 		if err != nil {
-			return err
+			printZipError(r.out, dir, err)
+			return nil, 1
+		}
+	}
+
+	if !*waitFlag {
+		id, err := insider.Upload(ctx)
+		if errors.Is(err, insiderci.ErrEmptyDirectory) {
+			fmt.Fprintf(r.out, "Error: target '%s' has no files to analyze\n", dir)
+			return nil, 1
 		}
-		z, err := writer.Create(path)
 		if err != nil {
-			return err
+			printError(r.out, err)
+			return nil, 1
+		}
+		if code := r.keepChecksum(zipOut, insider.Checksum()); code != 0 {
+			return nil, code
+		}
+		// Only the ID is printed, so that it can be captured and given to
+		// -analysis-id by a later step.
+		if *outputFlag == "ndjson" {
+			return nil, 0
 		}
+		if r.multiple {
+			fmt.Fprintf(r.stdout, "component=%d ", component)
+		}
+		fmt.Fprintln(r.stdout, id)
+		return nil, 0
+	}
 
-		if _, err := io.Copy(z, f); err != nil {
-			return err
+	sast, err := insider.Start(ctx)
+	if errors.Is(err, insiderci.ErrEmptyDirectory) {
+		fmt.Fprintf(r.out, "Error: target '%s' has no files to analyze\n", dir)
+		return nil, 1
+	}
+	if err != nil {
+		printError(r.out, err)
+		return nil, 1
+	}
+	if code := r.keepChecksum(zipOut, sast.ArchiveSHA256); code != 0 {
+		return nil, code
+	}
+	sast.Timings.Zip = zipped
+	return sast, 0
+}
+
+// keepChecksum writes the SHA-256 of the zip kept by -keep-zip next to it, in
+// the format of sha256sum.
+func (r *runner) keepChecksum(zip *os.File, checksum string) int {
+	if zip == nil || !*keepZipFlag {
+		return 0
+	}
+	line := fmt.Sprintf("%s  %s\n", checksum, filepath.Base(zip.Name()))
+	if err := ioutil.WriteFile(zip.Name()+".sha256", []byte(line), 0644); err != nil {
+		fmt.Fprintf(r.out, "Error to save checksum: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// resume returns the results of the analysis id started by a previous run, or
+// nil with the exit code of the run.
+func (r *runner) resume(ctx context.Context, component, id int) (*insiderci.Sast, int) {
+	insider, err := insiderci.New(ctx, *emailFlag, *passwordFlag, "", component, r.opts...)
+	if err != nil {
+		printError(r.out, err)
+		return nil, 1
+	}
+	sast, err := insider.Resume(ctx, id)
+	if err != nil {
+		printError(r.out, err)
+		return nil, 1
+	}
+	return sast, 0
+}
+
+// printError prints err along with how to fix it, for the errors caused by
+// the settings of the run.
+func printError(out io.Writer, err error) {
+	fmt.Fprintf(out, "Error: %v\n", err)
+	switch {
+	case errors.Is(err, insiderci.ErrAuthFailed):
+		fmt.Fprintf(out, "Check -email and -password, -token or -api-key, and the %s, %s, %s and %s variables\n", insiderci.EmailEnv, insiderci.PasswordEnv, tokenEnv, apiKeyEnv)
+	case errors.As(err, &x509.UnknownAuthorityError{}), errors.As(err, &x509.HostnameError{}):
+		fmt.Fprintf(out, "The certificate of the Insider API is not trusted, give its CA with -ca-cert\n")
+	case errors.Is(err, context.Canceled):
+		fmt.Fprintf(out, "An analysis already started keeps running on the backend, its results can be collected with -analysis-id\n")
+	case errors.Is(err, insiderci.ErrAnalysisTimeout):
+		fmt.Fprintf(out, "The analysis did not finish within -timeout %s, consider increasing it\n", *timeoutFlag)
+	case errors.As(err, new(*insiderci.SizeError)):
+		fmt.Fprintln(out, sizeHint)
+	}
+}
+
+// sizeHint tells how to fix a directory zipped larger than -max-size.
+const sizeHint = "Use -exclude to trim the archive below -max-size"
+
+// printZipError prints the error of zipping dir.
+func printZipError(out io.Writer, dir string, err error) {
+	fmt.Fprintf(out, "Error to zip %s: %v\n", dir, err)
+	if errors.As(err, new(*insiderci.SizeError)) {
+		fmt.Fprintln(out, sizeHint)
+	}
+}
+
+// compressions maps -compression to the deflate level of the zip.
+var compressions = map[string]int{
+	"store":   flate.NoCompression,
+	"fast":    flate.BestSpeed,
+	"default": flate.DefaultCompression,
+	"best":    flate.BestCompression,
+}
+
+// parseSize parses sizes like 500MB, 2G or 1048576, in multiples of 1024.
+func parseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for i, unit := range []string{"K", "M", "G", "T"} {
+		for _, suffix := range []string{unit + "IB", unit + "B", unit} {
+			if strings.HasSuffix(value, suffix) {
+				value = strings.TrimSuffix(value, suffix)
+				multiplier = int64(1) << (10 * uint(i+1))
+				break
+			}
 		}
-		return nil
-	})
-	return zipOut.Name(), err
+		if multiplier > 1 {
+			break
+		}
+	}
+	if multiplier == 1 {
+		value = strings.TrimSuffix(value, "B")
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+func validateArchive(filename string) error {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func tempZip(dir string) (*os.File, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.TempFile("", fmt.Sprintf("%s-*.zip", filepath.Base(abs)))
 }
 
-func saveSast(component int, sast *insiderci.Sast) error {
-	b, err := json.MarshalIndent(sast, "", "\t")
+func saveSast(client *http.Client, report *template.Template, dir, name string, sast *insiderci.Sast, warn io.Writer) error {
+	b, err := insiderci.MarshalResult(sast)
 	if err != nil {
 		return err
 	}
-	file, err := os.Create(fmt.Sprintf("result-%d.json", component))
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	file, err := os.Create(filepath.Join(dir, name+".json"))
 	if err != nil {
 		return err
 	}
@@ -145,29 +1179,70 @@ func saveSast(component int, sast *insiderci.Sast) error {
 	if _, err := file.Write(b); err != nil {
 		return err
 	}
-	return saveSastHtml(component, sast)
+	return saveSastHtml(client, report, dir, name, sast, warn)
+}
+
+type reportData struct {
+	*insiderci.Sast
+	Style  template.CSS
+	CDNCSS bool
+	// TopFiles holds the riskiest files with -top-files.
+	TopFiles []insiderci.FileRisk
 }
 
-func saveSastHtml(component int, sast *insiderci.Sast) error {
-	tmpl, err := template.New("report").Parse(reportTemplate)
+// loadReportTemplate parses the -template file, or the built-in report when
+// filename is empty.
+func loadReportTemplate(filename string) (*template.Template, error) {
+	if filename == "" {
+		return template.New("report").Parse(reportTemplate)
+	}
+	text, err := ioutil.ReadFile(filename)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	file, err := os.Create(fmt.Sprintf("result-%d.html", component))
+	return template.New(filepath.Base(filename)).Parse(string(text))
+}
+
+// saveSastHtml writes the html report. With -cdn-css, a failed download of
+// style.css is only warned about on warn, since the report is already written.
+func saveSastHtml(client *http.Client, report *template.Template, dir, name string, sast *insiderci.Sast, warn io.Writer) error {
+	file, err := os.Create(filepath.Join(dir, name+".html"))
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	if err := tmpl.Execute(file, sast); err != nil {
+	data := reportData{Sast: sast, Style: template.CSS(reportStyle), CDNCSS: *cdnCSSFlag}
+	if *noDRAFlag {
+		shown := *sast
+		shown.SastDras = nil
+		data.Sast = &shown
+	}
+	if *topFilesFlag > 0 {
+		data.TopFiles = insiderci.FileRisks(sast.SastVulnerabilities, *topFilesFlag)
+	}
+	if err := report.Execute(file, data); err != nil {
 		return err
 	}
-	resp, err := http.Get("https://stackpath.bootstrapcdn.com/bootstrap/4.5.0/css/bootstrap.min.css")
+	if !data.CDNCSS {
+		return nil
+	}
+	if err := downloadStyle(client, dir); err != nil {
+		fmt.Fprintf(warn, "Warning: failed to download style.css, the html report is unstyled: %v\n", err)
+	}
+	return nil
+}
+
+func downloadStyle(client *http.Client, dir string) error {
+	resp, err := client.Get("https://stackpath.bootstrapcdn.com/bootstrap/4.5.0/css/bootstrap.min.css")
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download style.css: status code %d", resp.StatusCode)
+	}
 
-	out, err := os.Create("style.css")
+	out, err := os.Create(filepath.Join(dir, "style.css"))
 	if err != nil {
 		return err
 	}
@@ -177,11 +1252,14 @@ func saveSastHtml(component int, sast *insiderci.Sast) error {
 	return err
 }
 
-func resumeSast(out io.Writer, sast *insiderci.Sast) {
-	fmt.Fprintln(out, "-----------------------------------------------------------------------------------------------------------------------")
+// resumeSast prints the results, with the vulnerabilities grouped by the
+// field groupBy when set.
+func resumeSast(out io.Writer, sast *insiderci.Sast, diff *insiderci.Diff, groupBy string, topFiles int, timings bool, width int, color bool) {
+	separator := strings.Repeat("-", width)
+	fmt.Fprintln(out, separator)
 	fmt.Fprintf(out, "Score Security %v/100\n", sast.SecurityScore)
-	fmt.Fprintln(out, "-----------------------------------------------------------------------------------------------------------------------")
-	if len(sast.SastDras) > 0 {
+	fmt.Fprintln(out, separator)
+	if len(sast.SastDras) > 0 && !*noDRAFlag {
 		fmt.Fprintf(out, "DRA - Data Risk Analytics\n")
 		for _, dra := range sast.SastDras[0:] {
 			fmt.Fprintf(out, "File: %s\n", dra.File)
@@ -191,19 +1269,69 @@ func resumeSast(out io.Writer, sast *insiderci.Sast) {
 	}
 
 	if len(sast.SastVulnerabilities) > 0 {
-		fmt.Fprintln(out, "-----------------------------------------------------------------------------------------------------------------------")
+		fmt.Fprintln(out, separator)
 		fmt.Fprintf(out, "Vulnerabilities\n")
-		for _, v := range sast.SastVulnerabilities[0:] {
-			fmt.Fprintf(out, "CVSS: %s\n", v.Cvss)
-			fmt.Fprintf(out, "Rank: %s\n", v.Rank)
-			fmt.Fprintf(out, "Class: %s\n", v.Class)
-			fmt.Fprintf(out, "Method: %s\n", v.Method)
-			fmt.Fprintf(out, "VulnerabilityID: %s\n", v.VulID)
-			fmt.Fprintf(out, "LongMessage: %s\n", v.LongMessage)
-			fmt.Fprintf(out, "ClassMessage: %s\n", v.ClassMessage)
-			fmt.Fprintf(out, "ShortMessage: %s\n\n", v.ShortMessage)
+		if groupBy == "" {
+			for _, v := range sast.SastVulnerabilities {
+				resumeVulnerability(out, v, "", color)
+			}
+		} else {
+			groups, _ := insiderci.GroupVulnerabilities(sast.SastVulnerabilities, groupBy)
+			for _, group := range groups {
+				fmt.Fprintf(out, "%s (%d)\n", group.Name, len(group.Vulnerabilities))
+				for _, v := range group.Vulnerabilities {
+					resumeVulnerability(out, v, "  ", color)
+				}
+			}
+		}
+	}
+
+	if risks := insiderci.FileRisks(sast.SastVulnerabilities, topFiles); topFiles > 0 && len(risks) > 0 {
+		fmt.Fprintln(out, separator)
+		fmt.Fprintf(out, "Riskiest files\n")
+		for _, risk := range risks {
+			fmt.Fprintf(out, "%6.1f  %3d vulnerabilities  %s\n", risk.Risk, risk.Vulnerabilities, risk.File)
 		}
 	}
 
-	fmt.Fprintln(out, "-----------------------------------------------------------------------------------------------------------------------")
+	if diff != nil {
+		fmt.Fprintln(out, separator)
+		fmt.Fprintf(out, "Compared with previous analysis: %d added, %d removed, %d unchanged\n",
+			len(diff.Added), len(diff.Removed), len(diff.Unchanged))
+		for _, v := range diff.Removed {
+			fmt.Fprintf(out, "Removed: %s %s.%s\n", v.VulID, v.Class, v.Method)
+		}
+	}
+
+	if timings {
+		fmt.Fprintln(out, separator)
+		fmt.Fprintf(out, "Timings: %s\n", sast.Timings)
+	}
+
+	fmt.Fprintln(out, separator)
+}
+
+// resumeVulnerability prints v with every line prefixed by indent, and its
+// rank colored with color.
+func resumeVulnerability(out io.Writer, v insiderci.SastVulnerability, indent string, color bool) {
+	fmt.Fprintf(out, "%sCVSS: %s\n", indent, v.Cvss)
+	fmt.Fprintf(out, "%sRank: %s\n", indent, colorRank(v.Rank, color))
+	fmt.Fprintf(out, "%sClass: %s\n", indent, v.Class)
+	fmt.Fprintf(out, "%sMethod: %s\n", indent, v.Method)
+	if location := v.Location(); location != "" {
+		fmt.Fprintf(out, "%sFile: %s\n", indent, location)
+	}
+	fmt.Fprintf(out, "%sVulnerabilityID: %s\n", indent, v.VulID)
+	if v.Baselined {
+		fmt.Fprintf(out, "%sBaselined: true\n", indent)
+	}
+	if v.Diff != "" {
+		fmt.Fprintf(out, "%sDiff: %s\n", indent, v.Diff)
+	}
+	if v.Occurrences > 1 {
+		fmt.Fprintf(out, "%sOccurrences: %d\n", indent, v.Occurrences)
+	}
+	fmt.Fprintf(out, "%sLongMessage: %s\n", indent, v.LongMessage)
+	fmt.Fprintf(out, "%sClassMessage: %s\n", indent, v.ClassMessage)
+	fmt.Fprintf(out, "%sShortMessage: %s\n\n", indent, v.ShortMessage)
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+// saveMarkdown writes a GitHub flavored markdown report, meant to be posted as
+// a pull request comment. LongMessage bodies longer than limit runes are
+// truncated; a limit of 0 keeps them whole. With groupBy, vulnerabilities are
+// listed under a header per class, file or rule.
+func saveMarkdown(filename string, sast *insiderci.Sast, diff *insiderci.Diff, limit int, groupBy string) error {
+	return ioutil.WriteFile(filename, markdown(sast, diff, limit, groupBy), 0644)
+}
+
+func markdown(sast *insiderci.Sast, diff *insiderci.Diff, limit int, groupBy string) []byte {
+	var out bytes.Buffer
+	summary := insiderci.Summarize(sast, insiderci.Policy{})
+
+	fmt.Fprintf(&out, "## Insider analysis\n\n")
+	fmt.Fprintf(&out, "**Score Security:** %s/100\n\n", sast.SecurityScore)
+	if diff != nil {
+		fmt.Fprintf(&out, "**Compared with previous analysis:** %d added, %d removed, %d unchanged\n\n",
+			len(diff.Added), len(diff.Removed), len(diff.Unchanged))
+	}
+
+	if summary.Total == 0 && summary.Baselined == 0 {
+		fmt.Fprintf(&out, "No vulnerabilities found.\n")
+		return out.Bytes()
+	}
+
+	fmt.Fprintf(&out, "| Rank | Vulnerabilities |\n|------|----------------:|\n")
+	for _, rank := range markdownRanks(summary.Counts) {
+		fmt.Fprintf(&out, "| %s | %d |\n", markdownCell(rank), summary.Counts[rank])
+	}
+	fmt.Fprintf(&out, "| **Total** | **%d** |\n", summary.Total)
+	if summary.Baselined > 0 {
+		fmt.Fprintf(&out, "| Baselined | %d |\n", summary.Baselined)
+	}
+	fmt.Fprintf(&out, "\n")
+
+	fmt.Fprintf(&out, "### Vulnerabilities\n\n")
+	if groupBy == "" {
+		for _, v := range sast.SastVulnerabilities {
+			markdownVulnerability(&out, v, limit)
+		}
+		return out.Bytes()
+	}
+	groups, _ := insiderci.GroupVulnerabilities(sast.SastVulnerabilities, groupBy)
+	for _, group := range groups {
+		fmt.Fprintf(&out, "#### `%s` (%d)\n\n", strings.Replace(group.Name, "`", "'", -1), len(group.Vulnerabilities))
+		for _, v := range group.Vulnerabilities {
+			markdownVulnerability(&out, v, limit)
+		}
+	}
+	return out.Bytes()
+}
+
+func markdownVulnerability(out *bytes.Buffer, v insiderci.SastVulnerability, limit int) {
+	baselined := ""
+	if v.Baselined {
+		baselined = " <i>(baselined)</i>"
+	}
+	if v.Diff == insiderci.DiffAdded {
+		baselined += " <i>(new)</i>"
+	}
+	fmt.Fprintf(out, "<details>\n<summary><b>%s</b> %s: %s%s</summary>\n\n",
+		html.EscapeString(v.Rank), html.EscapeString(v.VulID), html.EscapeString(v.ShortMessage), baselined)
+	fmt.Fprintf(out, "- **CVSS:** %s\n", html.EscapeString(v.Cvss))
+	fmt.Fprintf(out, "- **Class:** `%s`\n", strings.Replace(v.Class, "`", "'", -1))
+	fmt.Fprintf(out, "- **Method:** `%s`\n", strings.Replace(v.Method, "`", "'", -1))
+	if location := v.Location(); location != "" {
+		fmt.Fprintf(out, "- **File:** `%s`\n", strings.Replace(location, "`", "'", -1))
+	}
+	fmt.Fprintf(out, "\n%s\n\n</details>\n\n", html.EscapeString(truncate(v.LongMessage, limit)))
+}
+
+// markdownRanks lists the ranks found, from the most to the least severe,
+// followed by any rank unknown to the package.
+func markdownRanks(counts map[string]int) []string {
+	var ranks, unknown []string
+	for _, rank := range insiderci.Ranks {
+		if counts[rank] > 0 {
+			ranks = append(ranks, rank)
+		}
+	}
+	for rank := range counts {
+		if insiderci.Severity(rank) == 0 {
+			unknown = append(unknown, rank)
+		}
+	}
+	sort.Strings(unknown)
+	return append(ranks, unknown...)
+}
+
+func markdownCell(s string) string {
+	return strings.Replace(html.EscapeString(s), "|", "\\|", -1)
+}
+
+func truncate(s string, limit int) string {
+	runes := []rune(s)
+	if limit <= 0 || len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit]) + "…"
+}
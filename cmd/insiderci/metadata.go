@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+// branchEnv, commitEnv and tagEnv are the variables of the common CI services
+// that hold the branch, commit and tag being built, in order of precedence.
+var (
+	branchEnv = []string{"CI_COMMIT_REF_NAME", "GITHUB_HEAD_REF", "GITHUB_REF_NAME", "BITBUCKET_BRANCH", "BRANCH_NAME", "GIT_BRANCH"}
+	commitEnv = []string{"CI_COMMIT_SHA", "GITHUB_SHA", "BITBUCKET_COMMIT", "GIT_COMMIT"}
+	tagEnv    = []string{"CI_COMMIT_TAG", "BITBUCKET_TAG", "TAG_NAME"}
+)
+
+// runMetadata returns -branch, -commit and -tag, each detected from the CI
+// variables when not given, or nil when none is known.
+func runMetadata() *insiderci.Metadata {
+	meta := insiderci.Metadata{
+		Branch: flagOrEnv(*branchFlag, branchEnv),
+		Commit: flagOrEnv(*commitFlag, commitEnv),
+		Tag:    flagOrEnv(*tagFlag, tagEnv),
+	}
+	if meta == (insiderci.Metadata{}) {
+		return nil
+	}
+	return &meta
+}
+
+func flagOrEnv(value string, names []string) string {
+	if value != "" {
+		return value
+	}
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
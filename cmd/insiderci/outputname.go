@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultOutputName = "result-{component}"
+
+var placeholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// outputName fills the placeholders of the -output-name pattern: {component},
+// {branch} and {commit}, from -branch and -commit or the CI variables, and
+// {timestamp}, the UTC start of the run. Characters not allowed in file
+// names are replaced by -.
+func outputName(pattern string, component int, started time.Time) (string, error) {
+	var err error
+	name := placeholder.ReplaceAllStringFunc(pattern, func(p string) string {
+		switch p {
+		case "{component}":
+			return strconv.Itoa(component)
+		case "{branch}":
+			return fileSafe(flagOrEnv(*branchFlag, branchEnv))
+		case "{commit}":
+			return fileSafe(flagOrEnv(*commitFlag, commitEnv))
+		case "{timestamp}":
+			return started.UTC().Format("20060102T150405Z")
+		}
+		if err == nil {
+			err = fmt.Errorf("invalid -output-name %q: unknown placeholder %s, must be {component}, {branch}, {commit} or {timestamp}", pattern, p)
+		}
+		return p
+	})
+	if err != nil {
+		return "", err
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid -output-name %q: must be a file name, use -output-dir for its directory", pattern)
+	}
+	return name, nil
+}
+
+func fileSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>| `, r) {
+			return '-'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+var resultFile = regexp.MustCompile(`^result-(\d+)\.json$`)
+
+// runReport writes the files selected by the flags, such as -save, -sarif or
+// -markdown, from a result saved by -save, without analyzing again, and lists
+// its rules with -list-rules. Without any of them, the result is printed as
+// scan does. The component of the files is -component or the one in the
+// result file name. The class filters and -redact-paths apply as in scan.
+func runReport(args []string, out io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintf(out, "Error: report expects one result file, got %d\n", len(args))
+		return 1
+	}
+	if *rawFlag != "" {
+		fmt.Fprintf(out, "Error: -raw is not available from a saved result\n")
+		return 1
+	}
+	sast, err := insiderci.LoadSast(args[0])
+	if err != nil {
+		fmt.Fprintf(out, "Error to load result: %v\n", err)
+		return 1
+	}
+
+	component := 0
+	if len(componentFlag) > 0 {
+		component = componentFlag[0]
+	} else if m := resultFile.FindStringSubmatch(filepath.Base(args[0])); m != nil {
+		component, _ = strconv.Atoi(m[1])
+	}
+
+	report, err := loadReportTemplate(*templateFlag)
+	if err != nil {
+		fmt.Fprintf(out, "Error to load template: %v\n", err)
+		return 1
+	}
+	client, _, err := proxyClient()
+	if err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return 1
+	}
+	if *listRulesFlag != "" && *listRulesFlag != "text" && *listRulesFlag != "json" {
+		fmt.Fprintf(out, "Error: invalid -list-rules %q: must be text or json\n", *listRulesFlag)
+		return 1
+	}
+	if *groupByFlag != "" {
+		if _, err := insiderci.GroupVulnerabilities(nil, *groupByFlag); err != nil {
+			fmt.Fprintf(out, "Error: invalid -group-by: %v\n", err)
+			return 1
+		}
+	}
+	classFilter := insiderci.ClassFilter{Only: onlyClassFlag, Ignore: ignoreClassFlag}
+	if err := classFilter.Validate(); err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return 1
+	}
+
+	r := &runner{out: out, stdout: os.Stdout, progress: out, client: client, report: report, classes: classFilter}
+	r.width, r.color = outputWidth(r.stdout), useColor(r.stdout)
+	if n := r.classes.Apply(sast); n > 0 {
+		fmt.Fprintf(r.progress, "%d vulnerabilities left out by -only-class/-ignore-class\n", n)
+	}
+	insiderci.SortVulnerabilities(sast.SastVulnerabilities)
+	if code := r.redact(sast, nil, component); code != 0 {
+		return code
+	}
+
+	if *listRulesFlag != "" {
+		if err := listRules(r.stdout, sast.SastVulnerabilities, *listRulesFlag); err != nil {
+			fmt.Fprintf(out, "Error to list rules: %v\n", err)
+			return 1
+		}
+	}
+	if !reportSelected() {
+		resumeSast(r.stdout, sast, nil, *groupByFlag, *topFilesFlag, false, r.width, r.color)
+		return 0
+	}
+	return r.save(sast, nil, component, time.Now())
+}
+
+// reportSelected tells whether the flags select an output of report.
+func reportSelected() bool {
+	return *saveFlag || *sarifFlag != "" || *junitFlag != "" || *gitlabSastFlag != "" ||
+		*csvFlag != "" || *markdownFlag != "" || *listRulesFlag != ""
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+// ruleCount is a rule or a class listed by -list-rules.
+type ruleCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// listRules prints the distinct rules (VulID) and classes of the
+// vulnerabilities with their number of occurrences, the most frequent first,
+// as text or json.
+func listRules(out io.Writer, vulnerabilities []insiderci.SastVulnerability, format string) error {
+	rules := countGroups(vulnerabilities, insiderci.GroupByRule)
+	classes := countGroups(vulnerabilities, insiderci.GroupByClass)
+	if format == "json" {
+		data, err := json.MarshalIndent(struct {
+			Rules   []ruleCount `json:"rules"`
+			Classes []ruleCount `json:"classes"`
+		}{rules, classes}, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", data)
+		return err
+	}
+
+	fmt.Fprintf(out, "Rules\n")
+	for _, rule := range rules {
+		fmt.Fprintf(out, "%6d  %s\n", rule.Count, rule.Name)
+	}
+	fmt.Fprintf(out, "Classes\n")
+	for _, class := range classes {
+		fmt.Fprintf(out, "%6d  %s\n", class.Count, class.Name)
+	}
+	return nil
+}
+
+func countGroups(vulnerabilities []insiderci.SastVulnerability, by string) []ruleCount {
+	groups, _ := insiderci.GroupVulnerabilities(vulnerabilities, by)
+	counts := make([]ruleCount, len(groups))
+	for i, group := range groups {
+		counts[i] = ruleCount{Name: group.Name, Count: len(group.Vulnerabilities)}
+	}
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	return counts
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strconv"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+const (
+	sarifSchema  = "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json"
+	sarifVersion = "2.1.0"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string                 `json:"id"`
+	ShortDescription *sarifMessage          `json:"shortDescription,omitempty"`
+	FullDescription  *sarifMessage          `json:"fullDescription,omitempty"`
+	Properties       map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID        string                 `json:"ruleId"`
+	RuleIndex     int                    `json:"ruleIndex"`
+	Level         string                 `json:"level"`
+	Message       sarifMessage           `json:"message"`
+	Locations     []sarifLocation        `json:"locations,omitempty"`
+	Suppressions  []sarifSuppression     `json:"suppressions,omitempty"`
+	BaselineState string                 `json:"baselineState,omitempty"`
+	Properties    map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name,omitempty"`
+	FullyQualifiedName string `json:"fullyQualifiedName,omitempty"`
+	Kind               string `json:"kind,omitempty"`
+}
+
+func saveSarif(filename string, sast *insiderci.Sast, diff *insiderci.Diff) error {
+	b, err := json.MarshalIndent(toSarif(sast, diff), "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, b, 0644)
+}
+
+func toSarif(sast *insiderci.Sast, diff *insiderci.Diff) sarifLog {
+	driver := sarifDriver{
+		Name:           "insiderci",
+		Version:        version,
+		InformationURI: "https://insidersec.io",
+		Rules:          []sarifRule{},
+	}
+	results := []sarifResult{}
+	rules := make(map[string]int)
+
+	vulnerabilities := sast.SastVulnerabilities
+	if diff != nil {
+		// Vulnerabilities fixed since the previous analysis are reported as absent.
+		vulnerabilities = append(vulnerabilities[:len(vulnerabilities):len(vulnerabilities)], diff.Removed...)
+	}
+
+	for i, v := range vulnerabilities {
+		ruleID := v.VulID
+		if ruleID == "" {
+			ruleID = "unknown"
+		}
+		index, ok := rules[ruleID]
+		if !ok {
+			index = len(driver.Rules)
+			rules[ruleID] = index
+			rule := sarifRule{
+				ID:               ruleID,
+				ShortDescription: &sarifMessage{Text: v.ShortMessage},
+				FullDescription:  &sarifMessage{Text: v.LongMessage},
+			}
+			// GitHub code scanning reads the numeric severity from this property.
+			if cvss, ok := insiderci.ParseCvss(v.Cvss); ok {
+				rule.Properties = map[string]interface{}{"security-severity": strconv.FormatFloat(cvss, 'f', -1, 64)}
+			}
+			driver.Rules = append(driver.Rules, rule)
+		}
+
+		message := v.ShortMessage
+		if message == "" {
+			message = v.LongMessage
+		}
+		result := sarifResult{
+			RuleID:    ruleID,
+			RuleIndex: index,
+			Level:     sarifLevel(v.Rank),
+			Message:   sarifMessage{Text: message},
+			Locations: sarifLocations(v),
+			Properties: map[string]interface{}{
+				"rank": v.Rank,
+				"cvss": v.Cvss,
+			},
+		}
+		if v.Baselined {
+			result.Suppressions = []sarifSuppression{{Kind: "external", Justification: "baselined"}}
+		}
+		if diff != nil {
+			result.BaselineState = sarifBaselineState(v, i >= len(sast.SastVulnerabilities))
+		}
+		results = append(results, result)
+	}
+
+	return sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{
+			{Tool: sarifTool{Driver: driver}, Results: results},
+		},
+	}
+}
+
+func sarifLevel(rank string) string {
+	switch insiderci.NormalizeRank(rank) {
+	case insiderci.RankCritical, insiderci.RankHigh:
+		return "error"
+	case insiderci.RankMedium:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+func sarifBaselineState(v insiderci.SastVulnerability, removed bool) string {
+	switch {
+	case removed:
+		return "absent"
+	case v.Diff == insiderci.DiffUnchanged:
+		return "unchanged"
+	default:
+		return "new"
+	}
+}
+
+func sarifLocations(v insiderci.SastVulnerability) []sarifLocation {
+	var location sarifLocation
+
+	uri := v.File()
+	if uri != "" {
+		location.PhysicalLocation = &sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: uri},
+		}
+		if v.Line > 0 {
+			location.PhysicalLocation.Region = &sarifRegion{StartLine: v.Line, StartColumn: v.Column}
+		}
+	}
+	if v.Class != "" || v.Method != "" {
+		logical := sarifLogicalLocation{Name: v.Method, FullyQualifiedName: v.Class, Kind: "function"}
+		if v.Class != "" && v.Method != "" {
+			logical.FullyQualifiedName = v.Class + "." + v.Method
+		}
+		location.LogicalLocations = []sarifLogicalLocation{logical}
+	}
+
+	if location.PhysicalLocation == nil && location.LogicalLocations == nil {
+		return nil
+	}
+	return []sarifLocation{location}
+}
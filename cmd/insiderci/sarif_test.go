@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+func TestSarifSecuritySeverity(t *testing.T) {
+	sast := &insiderci.Sast{SastVulnerabilities: []insiderci.SastVulnerability{
+		{VulID: "a", Rank: insiderci.RankHigh, Cvss: "9.8 (AV:N)"},
+		{VulID: "b", Rank: insiderci.RankHigh, Cvss: "5,0"},
+		{VulID: "c", Rank: insiderci.RankHigh, Cvss: "n/a"},
+	}}
+	rules := toSarif(sast, nil).Runs[0].Tool.Driver.Rules
+	want := map[string]interface{}{"a": "9.8", "b": "5", "c": nil}
+	for _, rule := range rules {
+		got := rule.Properties["security-severity"]
+		if got != want[rule.ID] {
+			t.Errorf("rule %s: security-severity = %v, want %v", rule.ID, got, want[rule.ID])
+		}
+	}
+}
+
+// TestSarifStructure checks the saved log against the structure required by
+// SARIF 2.1.0, decoded without the types of sarif.go.
+func TestSarifStructure(t *testing.T) {
+	sast := &insiderci.Sast{SastVulnerabilities: []insiderci.SastVulnerability{
+		{VulID: "a", Rank: insiderci.RankHigh, ShortMessage: "SQL injection", Class: "src/db.go", Line: 42, Column: 7},
+		{VulID: "b", Rank: insiderci.RankLow, LongMessage: "Weak hash", Class: "src/hash.go"},
+	}}
+	filename := filepath.Join(t.TempDir(), "report.sarif")
+	if err := saveSarif(filename, sast, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log struct {
+		Schema  *string `json:"$schema"`
+		Version *string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  *string `json:"name"`
+					Rules []struct {
+						ID *string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results *[]struct {
+				RuleID    string `json:"ruleId"`
+				RuleIndex *int   `json:"ruleIndex"`
+				Level     string `json:"level"`
+				Message   struct {
+					Text *string `json:"text"`
+				} `json:"message"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI *string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region *struct {
+							StartLine int `json:"startLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(b, &log); err != nil {
+		t.Fatal(err)
+	}
+
+	if log.Version == nil || *log.Version != "2.1.0" {
+		t.Errorf("version = %v, want 2.1.0", log.Version)
+	}
+	if log.Schema == nil || *log.Schema != sarifSchema {
+		t.Errorf("$schema = %v, want %s", log.Schema, sarifSchema)
+	}
+	if len(log.Runs) != 1 {
+		t.Fatalf("%d runs, want 1", len(log.Runs))
+	}
+	run := log.Runs[0]
+	if run.Tool.Driver.Name == nil || *run.Tool.Driver.Name != "insiderci" {
+		t.Errorf("runs[0].tool.driver.name = %v, want insiderci", run.Tool.Driver.Name)
+	}
+	if run.Results == nil {
+		t.Fatal("runs[0].results missing")
+	}
+	results := *run.Results
+	if len(results) != len(sast.SastVulnerabilities) {
+		t.Fatalf("%d results, want %d", len(results), len(sast.SastVulnerabilities))
+	}
+	wantText := []string{"SQL injection", "Weak hash"}
+	wantURI := []string{"src/db.go", "src/hash.go"}
+	wantLine := []int{42, 0}
+	for n, result := range results {
+		if result.Message.Text == nil || *result.Message.Text != wantText[n] {
+			t.Errorf("results[%d].message.text = %v, want %q", n, result.Message.Text, wantText[n])
+		}
+		if result.RuleIndex == nil || *result.RuleIndex >= len(run.Tool.Driver.Rules) ||
+			*run.Tool.Driver.Rules[*result.RuleIndex].ID != result.RuleID {
+			t.Errorf("results[%d].ruleIndex does not point to rule %q", n, result.RuleID)
+		}
+		switch result.Level {
+		case "none", "note", "warning", "error":
+		default:
+			t.Errorf("results[%d].level = %q", n, result.Level)
+		}
+		if len(result.Locations) != 1 {
+			t.Errorf("results[%d]: %d locations, want 1", n, len(result.Locations))
+			continue
+		}
+		location := result.Locations[0].PhysicalLocation
+		if location.ArtifactLocation.URI == nil || *location.ArtifactLocation.URI != wantURI[n] {
+			t.Errorf("results[%d].locations[0] uri = %v, want %s", n, location.ArtifactLocation.URI, wantURI[n])
+		}
+		switch {
+		case wantLine[n] == 0 && location.Region != nil:
+			t.Errorf("results[%d].locations[0] has a region without a line", n)
+		case wantLine[n] > 0 && (location.Region == nil || location.Region.StartLine != wantLine[n]):
+			t.Errorf("results[%d].locations[0] region = %v, want startLine %d", n, location.Region, wantLine[n])
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+// reportStyle covers the subset of Bootstrap 4 used by reportTemplate, so the
+// report renders without network access.
+const reportStyle = `
+*, *::before, *::after { box-sizing: border-box; }
+body { margin: 0; color: #212529; background-color: #fff; line-height: 1.5; }
+h6 { margin-top: 0; margin-bottom: .5rem; font-size: 1rem; font-weight: 500; line-height: 1.2; }
+p { margin-top: 0; margin-bottom: 1rem; }
+b { font-weight: bolder; }
+hr { margin: 1rem 0; border: 0; border-top: 1px solid rgba(0, 0, 0, .1); }
+img { vertical-align: middle; border-style: none; }
+.container { width: 100%; max-width: 1140px; padding-right: 15px; padding-left: 15px; margin-right: auto; margin-left: auto; }
+.row { display: flex; flex-wrap: wrap; margin-right: -15px; margin-left: -15px; }
+.col-4, .col-12 { position: relative; width: 100%; padding-right: 15px; padding-left: 15px; }
+.col-4 { flex: 0 0 33.333333%; max-width: 33.333333%; }
+.col-12 { flex: 0 0 100%; max-width: 100%; }
+.img-fluid { max-width: 100%; height: auto; }
+.table { width: 100%; margin-bottom: 1rem; color: #212529; border-collapse: collapse; }
+.table td, .table th { padding: .75rem; vertical-align: top; border-top: 1px solid #dee2e6; }
+.table-sm td, .table-sm th { padding: .3rem; }
+.table-responsive { display: block; width: 100%; overflow-x: auto; }
+.text-break { word-wrap: break-word; word-break: break-word; }
+.user-select-all { user-select: all; }
+`
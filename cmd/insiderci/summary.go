@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+// summaryFile is the JSON written to -summary, a small alternative to the
+// saved results for dashboards.
+type summaryFile struct {
+	Component  int                 `json:"component"`
+	AnalysisID int                 `json:"analysisId"`
+	Timestamp  time.Time           `json:"timestamp"`
+	Metadata   *insiderci.Metadata `json:"metadata,omitempty"`
+	insiderci.Summary
+}
+
+func saveSummary(filename string, sast *insiderci.Sast, component int, summary insiderci.Summary) error {
+	data, err := json.MarshalIndent(summaryFile{
+		Component:  component,
+		AnalysisID: sast.ID,
+		Timestamp:  time.Now().UTC().Truncate(time.Second),
+		Metadata:   sast.Metadata,
+		Summary:    summary,
+	}, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
@@ -10,11 +10,15 @@ const reportTemplate = `
       content="width=device-width, initial-scale=1, shrink-to-fit=no"
     />
     <title>Report</title>
+    {{ if .CDNCSS }}
     <link href="./style.css" rel="stylesheet" />
     <link
       href="https://fonts.googleapis.com/css2?family=Inconsolata:wght@300&display=swap"
       rel="stylesheet"
     />
+    {{ else }}
+    <style>{{ .Style }}</style>
+    {{ end }}
   </head>
   <style>
     body {
@@ -44,6 +48,7 @@ const reportTemplate = `
       <div class="row"></div>
       <hr />
       <hr />
+      {{ if .SastDras }}
       <div class="row">
         <div class="col-12">
           <h6>DRA - Data Risk Analytics</h6>
@@ -64,6 +69,34 @@ const reportTemplate = `
           </div>
         </div>
       </div>
+      {{ end }}
+      {{ if .TopFiles }}
+      <div class="row">
+        <div class="col-12">
+          <h6>Riskiest files</h6>
+          <div class="table-responsive">
+            <table class="table table-sm">
+              <thead>
+                <tr>
+                  <th>File</th>
+                  <th>Vulnerabilities</th>
+                  <th>Risk</th>
+                </tr>
+              </thead>
+              <tbody>
+                {{ range .TopFiles }}
+                <tr>
+                  <td class="user-select-all">{{ .File }}</td>
+                  <td>{{ .Vulnerabilities }}</td>
+                  <td>{{ printf "%.1f" .Risk }}</td>
+                </tr>
+                {{ end }}
+              </tbody>
+            </table>
+          </div>
+        </div>
+      </div>
+      {{ end }}
       {{ if .SastVulnerabilities }}
       <div class="row">
         <div class="col-12">
@@ -78,6 +111,7 @@ const reportTemplate = `
                       <b>CVSS :</b>{{ .Cvss }}<br />
                       <b>Rank :</b>{{ .Rank}}<br />
                       <b>Class :</b>{{ .Class}}<br />
+                      <b>File :</b>{{ .Location }}<br />
                       <b>VulnerabilityID :</b>{{ .VulID}}<br />
                       <b>Method :</b>{{ .Method}}<br />
                       <b>LongMessage :</b>{{ .LongMessage}}<br />
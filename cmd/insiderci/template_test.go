@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+func TestReportEscapesMessages(t *testing.T) {
+	custom := filepath.Join(t.TempDir(), "custom.html")
+	text := `<ul>{{ range .SastVulnerabilities }}<li title="{{ .ShortMessage }}">{{ .LongMessage }}</li>{{ end }}</ul>`
+	if err := ioutil.WriteFile(custom, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sast := &insiderci.Sast{
+		SecurityScore: 50,
+		SastVulnerabilities: []insiderci.SastVulnerability{{
+			Rank:         insiderci.RankHigh,
+			LongMessage:  "<script>alert(1)</script>",
+			ShortMessage: `"><script>alert(2)</script>`,
+		}},
+	}
+
+	for _, filename := range []string{"", custom} {
+		report, err := loadReportTemplate(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		if err := saveSastHtml(http.DefaultClient, report, dir, "result", sast, ioutil.Discard); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, "result.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		html := string(b)
+		if strings.Contains(html, "<script>alert") {
+			t.Errorf("template %q: script not escaped:\n%s", filename, html)
+		}
+		if !strings.Contains(html, "&lt;script&gt;alert(1)") {
+			t.Errorf("template %q: escaped message missing:\n%s", filename, html)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strconv"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+// defaultWidth is the width of the results printed when it is not given by
+// -width, $COLUMNS or the terminal, as in most CI log viewers.
+const defaultWidth = 80
+
+// outputWidth returns the width of the results printed to w: -width when set,
+// otherwise $COLUMNS or the width of the terminal when w is one.
+func outputWidth(w io.Writer) int {
+	if *widthFlag > 0 {
+		return *widthFlag
+	}
+	f, ok := w.(*os.File)
+	if !ok || !isTerminal(f) {
+		return defaultWidth
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	if width := terminalWidth(f); width > 0 {
+		return width
+	}
+	return defaultWidth
+}
+
+// isTerminal tells whether f is a terminal rather than a file or a pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// rankColors are the ANSI colors of the ranks printed to a terminal.
+var rankColors = map[string]string{
+	insiderci.RankCritical: "\x1b[31m",
+	insiderci.RankHigh:     "\x1b[35m",
+	insiderci.RankMedium:   "\x1b[33m",
+}
+
+// useColor tells whether the results printed to w are colored: only on a
+// terminal, unless -no-color or $NO_COLOR is set, or -json moves them to the
+// stderr shared with the logs.
+func useColor(w io.Writer) bool {
+	if *noColorFlag || *jsonFlag || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && isTerminal(f)
+}
+
+// colorRank returns rank in its color when color is set.
+func colorRank(rank string, color bool) string {
+	code, ok := rankColors[insiderci.NormalizeRank(rank)]
+	if !color || !ok {
+		return rank
+	}
+	return code + rank + "\x1b[0m"
+}
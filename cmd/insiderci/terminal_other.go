@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import "os"
+
+// terminalWidth is not implemented on this OS, so the width of a terminal
+// is $COLUMNS or defaultWidth.
+func terminalWidth(f *os.File) int {
+	return 0
+}
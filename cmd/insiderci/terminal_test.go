@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+func TestOutputWidthOutsideTerminal(t *testing.T) {
+	os.Setenv("COLUMNS", "50")
+	defer os.Unsetenv("COLUMNS")
+	file, err := ioutil.TempFile(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	for _, w := range []io.Writer{&bytes.Buffer{}, file} {
+		if width := outputWidth(w); width != defaultWidth {
+			t.Errorf("outputWidth(%T) = %d, want %d", w, width, defaultWidth)
+		}
+	}
+
+	*widthFlag = 30
+	defer func() { *widthFlag = 0 }()
+	if width := outputWidth(file); width != 30 {
+		t.Errorf("outputWidth with -width 30 = %d", width)
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	defer os.Setenv("NO_COLOR", os.Getenv("NO_COLOR"))
+	os.Unsetenv("NO_COLOR")
+	// The null device is a character device, which isTerminal takes for a
+	// terminal.
+	tty, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tty.Close()
+	if !isTerminal(tty) {
+		t.Skipf("%s is not a character device", os.DevNull)
+	}
+	file, err := ioutil.TempFile(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if !useColor(tty) {
+		t.Error("useColor(terminal) = false")
+	}
+	for _, w := range []io.Writer{&bytes.Buffer{}, file} {
+		if useColor(w) {
+			t.Errorf("useColor(%T) = true outside a terminal", w)
+		}
+	}
+
+	os.Setenv("NO_COLOR", "1")
+	if useColor(tty) {
+		t.Error("useColor(terminal) = true with $NO_COLOR")
+	}
+	os.Unsetenv("NO_COLOR")
+
+	*noColorFlag = true
+	if useColor(tty) {
+		t.Error("useColor(terminal) = true with -no-color")
+	}
+	*noColorFlag = false
+
+	*jsonFlag = true
+	if useColor(tty) {
+		t.Error("useColor(terminal) = true with -json")
+	}
+	*jsonFlag = false
+}
+
+func TestColorRank(t *testing.T) {
+	for _, test := range []struct {
+		rank, want string
+	}{
+		{insiderci.RankCritical, "\x1b[31mcritical\x1b[0m"},
+		{insiderci.RankHigh, "\x1b[35mhigh\x1b[0m"},
+		{insiderci.RankMedium, "\x1b[33mmedium\x1b[0m"},
+		{"HIGH", "\x1b[35mHIGH\x1b[0m"},
+		{insiderci.RankLow, "low"},
+		{insiderci.RankInfo, "info"},
+		{"unknown", "unknown"},
+	} {
+		if got := colorRank(test.rank, true); got != test.want {
+			t.Errorf("colorRank(%q, true) = %q, want %q", test.rank, got, test.want)
+		}
+		if got := colorRank(test.rank, false); got != test.rank {
+			t.Errorf("colorRank(%q, false) = %q, want it plain", test.rank, got)
+		}
+	}
+}
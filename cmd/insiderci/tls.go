@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// tlsConfig builds the TLS settings of the API calls from -ca-cert,
+// -client-cert, -client-key and -insecure, or returns nil without any of them.
+func tlsConfig() (*tls.Config, error) {
+	if *caCertFlag == "" && *clientCertFlag == "" && *clientKeyFlag == "" && !*insecureFlag {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: *insecureFlag}
+
+	if *caCertFlag != "" {
+		pem, err := ioutil.ReadFile(*caCertFlag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -ca-cert: %w", err)
+		}
+		// The CA is trusted along with the system ones, so that the SaaS
+		// endpoints keep working.
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("invalid -ca-cert: no PEM certificate found in %s", *caCertFlag)
+		}
+		config.RootCAs = pool
+	}
+
+	if (*clientCertFlag == "") != (*clientKeyFlag == "") {
+		return nil, errors.New("-client-cert and -client-key must be given together")
+	}
+	if *clientCertFlag != "" {
+		cert, err := tls.LoadX509KeyPair(*clientCertFlag, *clientKeyFlag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -client-cert/-client-key: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
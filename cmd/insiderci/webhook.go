@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+const webhookRetries = 2
+
+// webhookPayload is the JSON posted to -webhook. Text is the field shown by
+// Slack and Teams incoming webhooks.
+type webhookPayload struct {
+	Text      string `json:"text"`
+	Component int    `json:"component"`
+	insiderci.Summary
+}
+
+// notify posts the summary of the analysis of component to url, retrying
+// failed attempts up to webhookRetries times until ctx is done.
+func notify(ctx context.Context, client *http.Client, url string, timeout time.Duration, component int, summary insiderci.Summary) error {
+	status := "passed"
+	if summary.Failed {
+		status = "failed: " + summary.Reason
+	}
+	body, err := json.Marshal(webhookPayload{
+		Text:      fmt.Sprintf("insiderci: component %d %s (%s)", component, status, summary.Line()),
+		Component: component,
+		Summary:   summary,
+	})
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = post(ctx, client, url, timeout, body)
+		if err == nil || attempt >= webhookRetries {
+			return err
+		}
+		select {
+		case <-time.After(time.Second << uint(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func post(ctx context.Context, client *http.Client, url string, timeout time.Duration, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return nil
+}
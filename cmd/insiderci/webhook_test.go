@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gitlab.inlabs.app/cyber/insiderci"
+)
+
+func TestNotifyCancelled(t *testing.T) {
+	release := make(chan struct{})
+	handlers := map[string]http.HandlerFunc{
+		"hanging": func(w http.ResponseWriter, r *http.Request) { <-release },
+		"failing": func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadGateway) },
+	}
+	for name, handler := range handlers {
+		server := httptest.NewServer(handler)
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+
+		started := time.Now()
+		err := notify(ctx, server.Client(), server.URL, time.Minute, 1, insiderci.Summary{})
+		if elapsed := time.Since(started); elapsed > 2*time.Second {
+			t.Errorf("%s: notify returned after %v, want as soon as cancelled", name, elapsed)
+		}
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: notify error = %v, want context.Canceled", name, err)
+		}
+		cancel()
+		if name == "hanging" {
+			close(release)
+		}
+		server.Close()
+	}
+}
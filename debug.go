@@ -0,0 +1,56 @@
+package insiderci
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WithDebug logs the method, URL, headers, status code and duration of every
+// HTTP request, including retries, to w. The Authorization header is redacted
+// and request bodies, which carry the password, are never logged.
+func WithDebug(w io.Writer) Option {
+	return func(i *Insider) {
+		i.debug = log.New(w, "debug: ", log.LstdFlags|log.Lmicroseconds)
+	}
+}
+
+func (i *Insider) debugRequest(req *http.Request, attempt int) {
+	if i.debug == nil {
+		return
+	}
+	i.debug.Printf("%s %s attempt %d headers %s", req.Method, req.URL, attempt+1, redactHeaders(req.Header))
+}
+
+func (i *Insider) debugResponse(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+	if i.debug == nil {
+		return
+	}
+	elapsed = elapsed.Round(time.Millisecond)
+	if err != nil {
+		i.debug.Printf("%s %s failed after %s: %v", req.Method, req.URL, elapsed, err)
+		return
+	}
+	i.debug.Printf("%s %s returned %s in %s", req.Method, req.URL, resp.Status, elapsed)
+}
+
+func redactHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(header[name], ",")
+		if name == "Authorization" {
+			value = "REDACTED"
+		}
+		pairs = append(pairs, name+"="+value)
+	}
+	return "[" + strings.Join(pairs, " ") + "]"
+}
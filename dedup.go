@@ -0,0 +1,69 @@
+package insiderci
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const DefaultDedupKey = "vulid,class,method"
+
+var dedupFields = map[string]func(v SastVulnerability) string{
+	"vulid":   func(v SastVulnerability) string { return v.VulID },
+	"class":   func(v SastVulnerability) string { return v.Class },
+	"method":  func(v SastVulnerability) string { return v.Method },
+	"line":    func(v SastVulnerability) string { return strconv.Itoa(v.Line) },
+	"cwe":     func(v SastVulnerability) string { return v.Cwe },
+	"rank":    func(v SastVulnerability) string { return NormalizeRank(v.Rank) },
+	"message": func(v SastVulnerability) string { return normalizeMessage(v.ShortMessage) },
+}
+
+// ParseDedupKey parses a comma separated list of the vulnerability fields two
+// vulnerabilities must share to be duplicates: vulid, class, method, line,
+// cwe, rank and message.
+func ParseDedupKey(list string) (func(v SastVulnerability) string, error) {
+	var fields []func(v SastVulnerability) string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		field, ok := dedupFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown dedup field %q", name)
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty dedup key")
+	}
+	return func(v SastVulnerability) string {
+		parts := make([]string, len(fields))
+		for i, field := range fields {
+			parts[i] = field(v)
+		}
+		return strings.Join(parts, "\x00")
+	}, nil
+}
+
+// Deduplicate collapses vulnerabilities sharing the same key into the first
+// of them, keeping the original order and counting them in Occurrences.
+func Deduplicate(vulnerabilities []SastVulnerability, key func(v SastVulnerability) string) []SastVulnerability {
+	index := make(map[string]int)
+	var deduped []SastVulnerability
+	for _, v := range vulnerabilities {
+		occurrences := v.Occurrences
+		if occurrences == 0 {
+			occurrences = 1
+		}
+		k := key(v)
+		if i, ok := index[k]; ok {
+			deduped[i].Occurrences += occurrences
+			continue
+		}
+		index[k] = len(deduped)
+		v.Occurrences = occurrences
+		deduped = append(deduped, v)
+	}
+	return deduped
+}
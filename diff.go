@@ -0,0 +1,102 @@
+package insiderci
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// SchemaVersion is the version of the result JSON written by MarshalResult.
+// It is increased whenever a field is removed or changes type.
+const SchemaVersion = 1
+
+const (
+	DiffAdded     = "added"
+	DiffUnchanged = "unchanged"
+)
+
+// Diff compares the vulnerabilities of two analyses by Fingerprint.
+type Diff struct {
+	Added     []SastVulnerability `json:"added"`
+	Removed   []SastVulnerability `json:"removed"`
+	Unchanged []SastVulnerability `json:"unchanged"`
+}
+
+// Compare computes the vulnerabilities added, removed and unchanged since
+// previous, and marks each vulnerability of current with DiffAdded or
+// DiffUnchanged. When only one of them is Redacted, the classes of the other
+// are redacted the same way before being fingerprinted.
+func Compare(previous, current *Sast) *Diff {
+	diff := &Diff{
+		Added:     []SastVulnerability{},
+		Removed:   []SastVulnerability{},
+		Unchanged: []SastVulnerability{},
+	}
+
+	previousFingerprint := SastVulnerability.Fingerprint
+	currentFingerprint := SastVulnerability.Fingerprint
+	switch {
+	case previous.Redacted && !current.Redacted:
+		currentFingerprint = redactedFingerprint
+	case current.Redacted && !previous.Redacted:
+		previousFingerprint = redactedFingerprint
+	}
+
+	before := make(map[string]bool, len(previous.SastVulnerabilities))
+	for _, v := range previous.SastVulnerabilities {
+		before[previousFingerprint(v)] = true
+	}
+	after := make(map[string]bool, len(current.SastVulnerabilities))
+	for i, v := range current.SastVulnerabilities {
+		fingerprint := currentFingerprint(v)
+		after[fingerprint] = true
+		if before[fingerprint] {
+			current.SastVulnerabilities[i].Diff = DiffUnchanged
+			diff.Unchanged = append(diff.Unchanged, current.SastVulnerabilities[i])
+		} else {
+			current.SastVulnerabilities[i].Diff = DiffAdded
+			diff.Added = append(diff.Added, current.SastVulnerabilities[i])
+		}
+	}
+	for _, v := range previous.SastVulnerabilities {
+		if !after[previousFingerprint(v)] {
+			diff.Removed = append(diff.Removed, v)
+		}
+	}
+	return diff
+}
+
+// redactedFingerprint is the Fingerprint of v with its class redacted, which
+// is hashed the same by every Redactor.
+func redactedFingerprint(v SastVulnerability) string {
+	v.Class = NewRedactor().Path(v.Class)
+	return v.Fingerprint()
+}
+
+type result struct {
+	SchemaVersion int `json:"schemaVersion"`
+	*Sast
+}
+
+// MarshalResult encodes sast as the saved result JSON, the fields of Sast
+// along with schemaVersion.
+func MarshalResult(sast *Sast) ([]byte, error) {
+	return json.MarshalIndent(result{SchemaVersion: SchemaVersion, Sast: sast}, "", "\t")
+}
+
+// LoadSast reads a result saved as JSON, such as result-<component>.json.
+// Results without schemaVersion, saved before it was added, are accepted.
+func LoadSast(filename string) (*Sast, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	r := result{Sast: &Sast{}}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if r.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("%s: schema version %d is newer than the supported %d", filename, r.SchemaVersion, SchemaVersion)
+	}
+	return r.Sast, nil
+}
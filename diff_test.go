@@ -0,0 +1,101 @@
+package insiderci
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files of testdata")
+
+// golden compares got with the file testdata/name, or rewrites it with
+// -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	file := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(file, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the output, run go test -update if the change is intended:\n%s", file, got)
+	}
+}
+
+func TestCompareGolden(t *testing.T) {
+	previous, err := LoadSast(filepath.Join("testdata", "previous.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := LoadSast(filepath.Join("testdata", "current.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := Compare(previous, current)
+
+	result, err := MarshalResult(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "result.golden.json", append(result, '\n'))
+
+	b, err := json.MarshalIndent(diff, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "diff.golden.json", append(b, '\n'))
+}
+
+func TestCompareRedactedPrevious(t *testing.T) {
+	load := func(name string) *Sast {
+		sast, err := LoadSast(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sast
+	}
+	wantCurrent := load("current.json")
+	want := Compare(load("previous.json"), wantCurrent)
+
+	// A previous run with -redact-paths saved its result redacted.
+	previous := load("previous.json")
+	NewRedactor().Sast(previous)
+	b, err := MarshalResult(previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "result-7.json")
+	if err := ioutil.WriteFile(filename, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if previous, err = LoadSast(filename); err != nil {
+		t.Fatal(err)
+	}
+	if !previous.Redacted {
+		t.Fatal("redacted result not marked as redacted")
+	}
+
+	current := load("current.json")
+	got := Compare(previous, current)
+	if len(got.Added) != len(want.Added) || len(got.Removed) != len(want.Removed) || len(got.Unchanged) != len(want.Unchanged) {
+		t.Errorf("against the redacted result: %d added, %d removed, %d unchanged, want %d, %d, %d",
+			len(got.Added), len(got.Removed), len(got.Unchanged), len(want.Added), len(want.Removed), len(want.Unchanged))
+	}
+	for i, v := range current.SastVulnerabilities {
+		unredacted := wantCurrent.SastVulnerabilities[i]
+		if v.Diff != unredacted.Diff {
+			t.Errorf("vulnerabilities[%d].Diff = %q, want %q", i, v.Diff, unredacted.Diff)
+		}
+		if v.Class != unredacted.Class {
+			t.Errorf("vulnerabilities[%d]: class %q redacted by Compare, want %q", i, v.Class, unredacted.Class)
+		}
+	}
+}
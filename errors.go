@@ -0,0 +1,75 @@
+package insiderci
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors returned by New and Start when the backend refuses a step, or when a
+// step does not finish in time. Network failures are returned wrapped as they
+// are, so callers can tell both apart with errors.Is.
+var (
+	ErrAuthFailed      = errors.New("authentication failed")
+	ErrUpload          = errors.New("upload rejected")
+	ErrAnalysisFailed  = errors.New("analysis failed")
+	ErrAnalysisTimeout = errors.New("analysis timed out")
+
+	ErrComponentNotFound = errors.New("component not found")
+)
+
+// ComponentError is returned by Start when the backend does not know the
+// component, or the credentials can't access it. It matches
+// ErrComponentNotFound. Message is the explanation given by the backend, if
+// any.
+type ComponentError struct {
+	Component int
+	Message   string
+}
+
+func (e *ComponentError) Error() string {
+	msg := fmt.Sprintf("component %d not found or not accessible with these credentials", e.Component)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *ComponentError) Is(target error) bool {
+	return target == ErrComponentNotFound
+}
+
+// kindError marks err as one of the errors above while keeping it as the
+// cause, so errors.Is matches both.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.kind.Error() + ": " + e.err.Error()
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+// backendMessage returns the message of an error response of the backend,
+// {"message": "..."}, or the whole body when it has none.
+func backendMessage(body []byte) string {
+	var e sastError
+	if err := json.Unmarshal(body, &e); err == nil && e.Message != "" {
+		return e.Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// statusError formats an unexpected response of the backend.
+func statusError(status int, body []byte) error {
+	return fmt.Errorf("status code %d: %s", status, backendMessage(body))
+}
@@ -0,0 +1,58 @@
+package insiderci
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ClassFilter selects the vulnerabilities by Class: with Only, a class must
+// match one of its patterns, and it must match none of Ignore. Patterns are
+// exact class names or slash separated globs, where ** matches any number of
+// directories, as in WithExclude.
+type ClassFilter struct {
+	Only   []string
+	Ignore []string
+}
+
+func (f ClassFilter) Validate() error {
+	for _, pattern := range append(f.Only[:len(f.Only):len(f.Only)], f.Ignore...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid class pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Apply removes the vulnerabilities the filter does not select from sast,
+// counting them in its Filtered field, and returns how many were removed.
+func (f ClassFilter) Apply(sast *Sast) int {
+	kept := sast.SastVulnerabilities[:0]
+	removed := 0
+	for _, v := range sast.SastVulnerabilities {
+		if f.selects(v.Class) {
+			kept = append(kept, v)
+		} else {
+			removed++
+		}
+	}
+	sast.SastVulnerabilities = kept
+	sast.Filtered += removed
+	return removed
+}
+
+func (f ClassFilter) selects(class string) bool {
+	if len(f.Only) > 0 && !matchClass(class, f.Only) {
+		return false
+	}
+	return !matchClass(class, f.Ignore)
+}
+
+func matchClass(class string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == class || matchSegments(strings.Split(pattern, "/"), strings.Split(class, "/")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package insiderci
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Fingerprint identifies a vulnerability across analyses. It deliberately
+// leaves out the line and column so that unrelated edits moving the code
+// around do not change it.
+func (v SastVulnerability) Fingerprint() string {
+	h := sha256.New()
+	for _, part := range []string{v.VulID, v.Class, v.Method, normalizeMessage(v.ShortMessage)} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func normalizeMessage(message string) string {
+	return strings.ToLower(strings.Join(strings.Fields(message), " "))
+}
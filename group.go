@@ -0,0 +1,49 @@
+package insiderci
+
+import "fmt"
+
+// Fields vulnerabilities can be grouped by.
+const (
+	GroupByClass = "class"
+	GroupByFile  = "file"
+	// GroupByRule groups by VulID, the rule reporting the vulnerability.
+	GroupByRule = "rule"
+)
+
+// Group is a set of vulnerabilities sharing a class, a file or a rule.
+type Group struct {
+	Name            string
+	Vulnerabilities []SastVulnerability
+}
+
+// GroupVulnerabilities groups vulnerabilities by GroupByClass, GroupByFile or
+// GroupByRule.
+// Groups are in the order of their first vulnerability, so that sorted
+// vulnerabilities give the groups holding the most severe ones first.
+func GroupVulnerabilities(vulnerabilities []SastVulnerability, by string) ([]Group, error) {
+	var key func(v SastVulnerability) string
+	switch by {
+	case GroupByClass:
+		key = func(v SastVulnerability) string { return v.Class }
+	case GroupByFile:
+		key = SastVulnerability.File
+	case GroupByRule:
+		key = func(v SastVulnerability) string { return v.VulID }
+	default:
+		return nil, fmt.Errorf("invalid group %q: must be %s, %s or %s", by, GroupByClass, GroupByFile, GroupByRule)
+	}
+
+	var groups []Group
+	index := make(map[string]int)
+	for _, v := range vulnerabilities {
+		name := key(v)
+		n, ok := index[name]
+		if !ok {
+			n = len(groups)
+			index[name] = n
+			groups = append(groups, Group{Name: name})
+		}
+		groups[n].Vulnerabilities = append(groups[n].Vulnerabilities, v)
+	}
+	return groups, nil
+}
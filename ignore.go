@@ -0,0 +1,161 @@
+package insiderci
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type ignoreRule struct {
+	base     string
+	segments []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreFiles are the files with gitignore rules loaded from every directory.
+// The rules of .insiderignore only apply to the upload and, being loaded last,
+// can override the ones of .gitignore.
+var ignoreFiles = []string{".gitignore", ".insiderignore"}
+
+// gitignore matches slash separated paths, relative to the zip root, against
+// the rules of every ignore file loaded so far. Like git, the last matching
+// rule wins and the .git directory itself is always ignored.
+type gitignore struct {
+	rules []ignoreRule
+}
+
+func (g *gitignore) load(root, dir string) error {
+	for _, name := range ignoreFiles {
+		if err := g.loadFile(filepath.Join(root, dir, name), dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *gitignore) loadFile(filename, dir string) error {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	base := filepath.ToSlash(dir)
+	if base == "." {
+		base = ""
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimLeft(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.segments = strings.Split(line, "/")
+		g.rules = append(g.rules, rule)
+	}
+	return scanner.Err()
+}
+
+func (g *gitignore) match(name string, isDir bool) bool {
+	if isDir && path.Base(name) == ".git" {
+		return true
+	}
+	ignored := false
+	for _, rule := range g.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel := name
+		if rule.base != "" {
+			if !strings.HasPrefix(name, rule.base+"/") {
+				continue
+			}
+			rel = strings.TrimPrefix(name, rule.base+"/")
+		}
+		var matched bool
+		if rule.anchored {
+			matched = matchSegments(rule.segments, strings.Split(rel, "/"))
+		} else {
+			matched, _ = path.Match(rule.segments[0], path.Base(rel))
+		}
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// matchSegments matches path segments against pattern segments, where a "**"
+// segment matches zero or more directories, or everything inside a directory
+// when it is the last segment.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return len(name) > 0
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// excluded reports whether name, slash separated and relative to the zip root,
+// matches one of the WithExclude patterns. Matching is case-sensitive.
+func excluded(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePatterns reports the first malformed pattern given to WithExclude.
+func ValidatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
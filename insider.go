@@ -2,14 +2,23 @@ package insiderci
 
 import (
 	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -18,41 +27,93 @@ var (
 	SastURL   = "https://backend.insidersec.io"
 )
 
+const (
+	EmailEnv    = "INSIDER_EMAIL"
+	PasswordEnv = "INSIDER_PASSWORD"
+)
+
+var errNoCredentials = errors.New("no credentials provided: set -email/-password, INSIDER_EMAIL/INSIDER_PASSWORD or -api-key")
+
+const (
+	StatusRunning  = 1
+	StatusFinished = 2
+)
+
+const (
+	defaultPollInterval = time.Second
+	progressInterval    = 10 * time.Second
+	// emptyResultPolls is how many more times an analysis reported finished
+	// without any score or vulnerability is checked, as the backend may
+	// report it finished before its results are stored.
+	emptyResultPolls = 3
+)
+
 type sastError struct {
 	Message string `json:"message"`
 }
 
+type SastVulnerability struct {
+	ID            int      `json:"id"`
+	Cwe           string   `json:"cwe"`
+	Cvss          string   `json:"cvss"`
+	Rank          string   `json:"rank"`
+	Priority      string   `json:"priority"`
+	Category      string   `json:"category"`
+	ShortMessage  string   `json:"shortMessage"`
+	LongMessage   string   `json:"longMessage"`
+	Class         string   `json:"class"`
+	ClassMessage  string   `json:"classMessage"`
+	Method        string   `json:"method"`
+	MethodMessage string   `json:"methodMessage"`
+	Line          int      `json:"line"`
+	Column        int      `json:"column"`
+	Status        bool     `json:"status"`
+	Analyse       bool     `json:"analyse"`
+	VulID         string   `json:"vul_id"`
+	AffectedFiles []string `json:"affectedFiles"`
+	Occurrences   int      `json:"occurrences,omitempty"`
+	Baselined     bool     `json:"baselined,omitempty"`
+	Diff          string   `json:"diff,omitempty"`
+}
+
 type Sast struct {
-	ID                  int    `json:"id"`
-	Log                 string `json:"log"`
-	Status              int    `json:"status"`
-	SecurityScore       int    `json:"securityScore"`
-	SastVulnerabilities []struct {
-		ID            int      `json:"id"`
-		Cwe           string   `json:"cwe"`
-		Cvss          string   `json:"cvss"`
-		Rank          string   `json:"rank"`
-		Priority      string   `json:"priority"`
-		Category      string   `json:"category"`
-		ShortMessage  string   `json:"shortMessage"`
-		LongMessage   string   `json:"longMessage"`
-		Class         string   `json:"class"`
-		ClassMessage  string   `json:"classMessage"`
-		Method        string   `json:"method"`
-		MethodMessage string   `json:"methodMessage"`
-		Line          int      `json:"line"`
-		Column        int      `json:"column"`
-		Status        bool     `json:"status"`
-		Analyse       bool     `json:"analyse"`
-		VulID         string   `json:"vul_id"`
-		AffectedFiles []string `json:"affectedFiles"`
-	} `json:"vulnerabilities"`
-	SastDras []struct {
+	ID                  int                 `json:"id"`
+	Log                 string              `json:"log"`
+	Status              int                 `json:"status"`
+	SecurityScore       Score               `json:"securityScore"`
+	SastVulnerabilities []SastVulnerability `json:"vulnerabilities"`
+	SastDras            []struct {
 		Dra  string `json:"dra"`
 		File string `json:"file"`
 		ID   int    `json:"id"`
 		Type string `json:"type"`
 	} `json:"dra"`
+	// Raw is the body of the results response, with the fields Sast does not
+	// model. For paginated results, it is the first page.
+	Raw json.RawMessage `json:"-"`
+	// ScoreMissing reports results without a security score, or with a null
+	// one, decoded as 0.
+	ScoreMissing bool `json:"-"`
+	// Filtered counts the vulnerabilities removed by a ClassFilter.
+	Filtered int `json:"filtered,omitempty"`
+	// Timings is set by Start.
+	Timings Timings `json:"-"`
+	// ArchiveSHA256 is the hex SHA-256 of the uploaded package, set by Start.
+	ArchiveSHA256 string `json:"archiveSha256,omitempty"`
+	// FinishedAt is when the results were received, set by Start and Resume.
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// Metadata identifies the code analyzed. It is only kept in the saved
+	// results, the backend has no field for it.
+	Metadata *Metadata `json:"metadata,omitempty"`
+	// Redacted reports paths redacted by a Redactor.
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// Metadata is the branch, commit and tag of the code of an analysis.
+type Metadata struct {
+	Branch string `json:"branch,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	Tag    string `json:"tag,omitempty"`
 }
 
 type sastExecution struct {
@@ -67,107 +128,390 @@ type component struct {
 
 type Insider struct {
 	logger    *log.Logger
+	events    Logger
 	token     string
+	apiKey    string
+	email     string
+	password  string
 	filename  string
 	component int
+	uploadURL string
+	sastURL   string
+	stream    func(w io.Writer) error
+	// checksum is the hex SHA-256 of the package, set once it is uploaded.
+	checksum string
+
+	maxRetries int
+	// uploadRetries replaces maxRetries for the upload, when not negative.
+	uploadRetries int
+	retryDelay    time.Duration
+	random        *rand.Rand
+
+	proxy     *url.URL
+	tlsConfig *tls.Config
+	client    *http.Client
+
+	pollInterval time.Duration
+	debug        *log.Logger
+
+	archive archive
+}
+
+type Option func(*Insider)
+
+// WithAPIURL points every API call (auth, upload and polling) at a single
+// self-hosted Insider installation instead of the SaaS endpoints.
+func WithAPIURL(apiURL string) Option {
+	return func(i *Insider) {
+		i.uploadURL = apiURL
+		i.sastURL = apiURL
+	}
+}
+
+// WithPackageStream uploads whatever stream writes instead of reading the
+// package from disk, so large archives never have to be materialized. The
+// filename given to New is then only used as the name of the uploaded package.
+func WithPackageStream(stream func(w io.Writer) error) Option {
+	return func(i *Insider) {
+		i.stream = stream
+	}
+}
+
+// WithProxy sends every request through proxy instead of the proxy configured
+// by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables. It has no
+// effect with WithHTTPClient.
+func WithProxy(proxy *url.URL) Option {
+	return func(i *Insider) {
+		i.proxy = proxy
+	}
+}
+
+// WithTLSConfig sets the TLS settings of every request, e.g. the root CAs and
+// client certificates of a self-hosted installation. It has no effect with
+// WithHTTPClient.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(i *Insider) {
+		i.tlsConfig = config
+	}
+}
+
+// WithHTTPClient sends every request with client, for custom transports,
+// timeouts or root CAs. WithProxy and WithTLSConfig are then ignored; the
+// proxy and TLS settings are the ones of client.
+func WithHTTPClient(client *http.Client) Option {
+	return func(i *Insider) {
+		i.client = client
+	}
+}
+
+// WithProgress writes progress messages, such as the analysis still running,
+// to w instead of stderr. A nil w silences them.
+func WithProgress(w io.Writer) Option {
+	return func(i *Insider) {
+		if w == nil {
+			w = ioutil.Discard
+		}
+		i.logger.SetOutput(w)
+	}
+}
+
+func WithPollInterval(interval time.Duration) Option {
+	return func(i *Insider) {
+		i.pollInterval = interval
+	}
+}
+
+// WithToken reuses a token obtained by a previous login, see Token, instead of
+// logging in with email and password.
+func WithToken(token string) Option {
+	return func(i *Insider) {
+		i.token = token
+	}
+}
+
+// WithPassword logs in with email and password, as the arguments of New do.
+func WithPassword(email, password string) Option {
+	return func(i *Insider) {
+		i.email = email
+		i.password = password
+	}
+}
+
+// WithAPIKey authenticates every request with a personal access token of the
+// Insider account, sent as a bearer token, instead of logging in.
+func WithAPIKey(key string) Option {
+	return func(i *Insider) {
+		i.apiKey = key
+	}
+}
+
+// newInsider returns an Insider with the defaults overridden by opts.
+func newInsider(filename string, component int, opts []Option) *Insider {
+	i := &Insider{
+		logger:        log.New(os.Stderr, "", log.LstdFlags),
+		events:        nopLogger{},
+		filename:      filename,
+		component:     component,
+		uploadURL:     UploadURL,
+		sastURL:       SastURL,
+		maxRetries:    defaultMaxRetries,
+		uploadRetries: -1,
+		retryDelay:    defaultRetryDelay,
+		random:        rand.New(rand.NewSource(time.Now().UnixNano())),
+
+		pollInterval: defaultPollInterval,
+		archive:      archive{level: flate.DefaultCompression},
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
 }
 
-func New(email, password, filename string, component int) (*Insider, error) {
-	token, err := auhenticate(email, password)
+func New(ctx context.Context, email, password, filename string, component int, opts ...Option) (*Insider, error) {
+	i := newInsider(filename, component, opts)
+
+	if i.client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyFromEnvironment
+		if i.proxy != nil {
+			transport.Proxy = http.ProxyURL(i.proxy)
+		}
+		if i.tlsConfig != nil {
+			transport.TLSClientConfig = i.tlsConfig
+		}
+		i.client = &http.Client{Transport: transport}
+	}
+
+	var err error
+	if i.uploadURL, err = validateURL(i.uploadURL); err != nil {
+		return nil, err
+	}
+	if i.sastURL, err = validateURL(i.sastURL); err != nil {
+		return nil, err
+	}
+
+	if i.token != "" || i.apiKey != "" {
+		return i, nil
+	}
+
+	if email == "" {
+		email = i.email
+	}
+	if password == "" {
+		password = i.password
+	}
+	if email == "" {
+		email = os.Getenv(EmailEnv)
+	}
+	if password == "" {
+		password = os.Getenv(PasswordEnv)
+	}
+	if email == "" || password == "" {
+		return nil, errNoCredentials
+	}
+
+	started := time.Now()
+	token, err := i.auhenticate(ctx, email, password)
 	if err != nil {
-		return nil, fmt.Errorf("auhenticate %w", err)
+		i.events.Info("authentication failed", "duration", time.Since(started), "error", err.Error())
+		return nil, fmt.Errorf("authenticate: %w", err)
 	}
-	return &Insider{
-		logger:    log.New(os.Stderr, "", log.LstdFlags),
-		token:     token,
-		filename:  filename,
-		component: component,
-	}, nil
+	i.events.Info("authenticated", "duration", time.Since(started))
+	i.token = token
+	return i, nil
+}
+
+// Token returns the token used to authenticate, so it can be cached and given
+// to WithToken. The backend does not tell when it expires; once it does,
+// requests fail with status code 401 and a new login is needed.
+func (i *Insider) Token() string {
+	return i.token
+}
+
+func validateURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid api url %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid api url %q: scheme must be http or https", raw)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid api url %q: missing host", raw)
+	}
+	return strings.TrimRight(u.String(), "/"), nil
+}
+
+// Start uploads the package and waits for its analysis to finish.
+func (i *Insider) Start(ctx context.Context) (*Sast, error) {
+	started := time.Now()
+	id, err := i.Upload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	uploaded := time.Since(started)
+
+	result, err := i.wait(ctx, Sast{ID: id})
+	if err != nil {
+		return nil, err
+	}
+	result.Timings.Upload = uploaded
+	result.ArchiveSHA256 = i.checksum
+	return result, nil
 }
 
-func (i *Insider) Start() (*Sast, error) {
-	sast, err := i.startAnalysis()
+// Upload uploads the package and returns the ID of its analysis without
+// waiting for it, so that its results can be collected later with Resume.
+func (i *Insider) Upload(ctx context.Context) (int, error) {
+	if i.component <= 0 {
+		return 0, fmt.Errorf("invalid component ID %d", i.component)
+	}
+	started := time.Now()
+	i.events.Info("upload started", "component", i.component, "file", i.filename)
+	sast, err := i.startAnalysis(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("start analysis %w", err)
+		i.events.Info("upload failed", "component", i.component, "duration", time.Since(started), "error", err.Error())
+		return 0, fmt.Errorf("start analysis: %w", timeout(err))
+	}
+	i.events.Info("upload finished", "component", i.component, "sast_id", sast.ID, "duration", time.Since(started))
+	i.logger.Printf("Analysis %d started", sast.ID)
+	return sast.ID, nil
+}
+
+// Checksum returns the hex SHA-256 of the package uploaded by Upload or Start.
+func (i *Insider) Checksum() string {
+	return i.checksum
+}
+
+// Resume waits for the analysis id of the component, started by a previous
+// Start, and returns its results without uploading the package again, e.g.
+// when a CI job is retried.
+func (i *Insider) Resume(ctx context.Context, id int) (*Sast, error) {
+	if i.component <= 0 {
+		return nil, fmt.Errorf("invalid component ID %d", i.component)
 	}
-	sast, err = i.watchAnalysis(sast)
+	return i.wait(ctx, Sast{ID: id})
+}
+
+func (i *Insider) wait(ctx context.Context, sast Sast) (*Sast, error) {
+	started := time.Now()
+	sast, err := i.watchAnalysis(ctx, sast)
 	if err != nil {
-		return nil, fmt.Errorf("watch analysis %w", err)
+		i.events.Info("analysis failed", "component", i.component, "duration", time.Since(started), "error", err.Error())
+		return nil, fmt.Errorf("watch analysis: %w", timeout(err))
 	}
-	if sast.Status != 2 {
-		return nil, fmt.Errorf(sast.Log)
+	i.events.Info("analysis finished", "component", i.component, "sast_id", sast.ID, "status", sast.Status, "duration", time.Since(started))
+	sast.Timings.Scan = time.Since(started) - sast.Timings.Download
+	finished := time.Now().UTC().Truncate(time.Second)
+	sast.FinishedAt = &finished
+	if sast.Status != StatusFinished {
+		return nil, fmt.Errorf("%w: %s", ErrAnalysisFailed, sast.Log)
 	}
 	i.logger.Println("Analysis finish with successfull")
 	return &sast, nil
 }
 
-func (i *Insider) watchAnalysis(s Sast) (Sast, error) {
+// timeout marks the errors caused by the deadline of the context as
+// ErrAnalysisTimeout.
+func timeout(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &kindError{kind: ErrAnalysisTimeout, err: err}
+	}
+	return err
+}
+
+func (i *Insider) watchAnalysis(ctx context.Context, s Sast) (Sast, error) {
 	i.logger.Println("Waiting to finish analysis")
-	req, err := i.request(http.MethodGet, fmt.Sprintf("%s/api/sast/%d/component/%d/ci", SastURL, s.ID, i.component), nil)
+	req, err := i.request(ctx, http.MethodGet, fmt.Sprintf("%s/api/sast/%d/component/%d/ci", i.sastURL, s.ID, i.component), nil)
 	if err != nil {
 		return Sast{}, err
 	}
+	started := time.Now()
+	reported := started
+	empty := 0
 	for {
-		resp, err := http.DefaultClient.Do(req)
+		polled := time.Now()
+		resp, err := i.do(req)
 		if err != nil {
 			return Sast{}, err
 		}
 		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
 		if err != nil {
 			return Sast{}, err
 		}
 
 		if resp.StatusCode != http.StatusOK {
-			return Sast{}, fmt.Errorf("status code %d: %s", resp.StatusCode, string(b))
+			return Sast{}, statusError(resp.StatusCode, b)
 		}
 
 		var res Sast
 		if err := json.Unmarshal(b, &res); err != nil {
 			return Sast{}, err
 		}
-
-		if res.Status != 1 {
+		var score struct {
+			SecurityScore json.RawMessage `json:"securityScore"`
+		}
+		json.Unmarshal(b, &score)
+		res.ScoreMissing = len(score.SecurityScore) == 0 || string(score.SecurityScore) == "null"
+		i.events.Info("analysis status", "component", i.component, "sast_id", s.ID, "status", res.Status, "elapsed", time.Since(started))
+
+		if res.Status == StatusFinished && res.ScoreMissing && len(res.SastVulnerabilities) == 0 && empty < emptyResultPolls {
+			empty++
+			i.logger.Printf("Analysis %d finished without results yet, checking again", s.ID)
+			if err := sleep(ctx, i.pollInterval); err != nil {
+				return Sast{}, err
+			}
+			continue
+		}
+		if res.Status != StatusRunning {
+			if err := i.fetchPages(ctx, &res, resp.Header, req.URL); err != nil {
+				return Sast{}, err
+			}
+			res.Raw = b
+			// The last check downloads the results.
+			res.Timings.Download = time.Since(polled)
 			return res, nil
 		}
 
-		if err := resp.Body.Close(); err != nil {
-			return Sast{}, err
+		if time.Since(reported) >= progressInterval {
+			reported = time.Now()
+			i.logger.Printf("Analysis %d still running, %s elapsed", s.ID, time.Since(started).Round(time.Second))
 		}
 
-		time.Sleep(1 * time.Second)
+		if err := sleep(ctx, i.pollInterval); err != nil {
+			return Sast{}, err
+		}
 	}
 }
 
-func (i *Insider) startAnalysis() (Sast, error) {
+func (i *Insider) startAnalysis(ctx context.Context) (Sast, error) {
 	i.logger.Println("Starting analysis")
-	file, err := os.Open(i.filename)
+	body, contentType, checksum, err := i.packageBody()
 	if err != nil {
 		return Sast{}, err
 	}
-	defer file.Close()
-
-	body := new(bytes.Buffer)
-	writer := multipart.NewWriter(body)
 
-	part, err := writer.CreateFormFile("package", file.Name())
+	req, err := i.request(ctx, http.MethodPost, fmt.Sprintf("%s/core/api/v1/sast/%d", i.uploadURL, i.component), body)
 	if err != nil {
 		return Sast{}, err
 	}
-
-	if _, err := io.Copy(part, file); err != nil {
-		return Sast{}, err
-	}
-	if err := writer.Close(); err != nil {
-		return Sast{}, err
+	req.Header.Set("Content-Type", contentType)
+	if body, ok := body.(*filePartBody); ok {
+		req.ContentLength = body.part.size
+		req.GetBody = func() (io.ReadCloser, error) {
+			return body.part.open()
+		}
 	}
+	i.reportUpload(req)
 
-	req, err := i.request(http.MethodPost, fmt.Sprintf("%s/core/api/v1/sast/%d", UploadURL, i.component), body)
-	if err != nil {
-		return Sast{}, err
+	retries := i.maxRetries
+	if i.uploadRetries >= 0 {
+		retries = i.uploadRetries
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := i.doRetry(req, retries)
+	i.checksum = checksum()
 	if err != nil {
 		return Sast{}, err
 	}
@@ -178,15 +522,13 @@ func (i *Insider) startAnalysis() (Sast, error) {
 		return Sast{}, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden {
 		var sastErr sastError
-		if err := json.Unmarshal(b, &sastErr); err != nil {
-			return Sast{}, fmt.Errorf("unexpected error response: %s", string(b))
-		}
-		if len(sastErr.Message) == 0 {
-			return Sast{}, fmt.Errorf("unexpected error response: %s", string(b))
-		}
-		return Sast{}, fmt.Errorf(sastErr.Message)
+		json.Unmarshal(b, &sastErr)
+		return Sast{}, &ComponentError{Component: i.component, Message: sastErr.Message}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Sast{}, fmt.Errorf("%w: %v", ErrUpload, statusError(resp.StatusCode, b))
 	}
 
 	var s sastExecution
@@ -197,17 +539,137 @@ func (i *Insider) startAnalysis() (Sast, error) {
 	return s.SastCreated, nil
 }
 
-func (i *Insider) request(method, url string, body io.Reader) (*http.Request, error) {
-	// TODO add timeout
-	req, err := http.NewRequest(method, url, body)
+// reportUpload logs the progress of sending the body of req, including when
+// it is sent again by a retry.
+func (i *Insider) reportUpload(req *http.Request) {
+	req.Body = newProgressReader(req.Body, req.ContentLength, i.logger)
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return newProgressReader(body, req.ContentLength, i.logger), nil
+		}
+	}
+}
+
+// packageBody returns the multipart body of the package and its content
+// type. checksum returns the hex SHA-256 of the package once the request is
+// done; for a stream, it stops and waits for the goroutine writing it, and
+// is empty when the stream was not written whole.
+func (i *Insider) packageBody() (body io.Reader, contentType string, checksum func() string, err error) {
+	if i.stream != nil {
+		pr, pw := io.Pipe()
+		writer := multipart.NewWriter(pw)
+		done := make(chan string, 1)
+		go func() {
+			sum := ""
+			part, err := writer.CreateFormFile("package", i.filename)
+			if err == nil {
+				hash := sha256.New()
+				err = i.stream(io.MultiWriter(part, hash))
+				sum = hex.EncodeToString(hash.Sum(nil))
+			}
+			if err == nil {
+				err = writer.Close()
+			}
+			if err != nil {
+				sum = ""
+			}
+			pw.CloseWithError(err)
+			done <- sum
+		}()
+		checksum := func() string {
+			// The backend may answer before reading the whole body.
+			pr.Close()
+			return <-done
+		}
+		return pr, writer.FormDataContentType(), checksum, nil
+	}
+
+	// The file is read from disk as it is sent, between the multipart
+	// header and trailer, instead of being copied into memory.
+	file, err := os.Open(i.filename)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	var envelope bytes.Buffer
+	writer := multipart.NewWriter(&envelope)
+	if _, err := writer.CreateFormFile("package", i.filename); err != nil {
+		return nil, "", nil, err
+	}
+	headerSize := envelope.Len()
+	if err := writer.Close(); err != nil {
+		return nil, "", nil, err
+	}
+	part := &filePart{
+		filename: i.filename,
+		header:   envelope.Bytes()[:headerSize],
+		trailer:  envelope.Bytes()[headerSize:],
+	}
+	part.size = int64(len(part.header)) + size + int64(len(part.trailer))
+	opened, err := part.open()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return opened, writer.FormDataContentType(), func() string { return sum }, nil
+}
+
+// filePart is the multipart body of a package file, which can be opened
+// again for retries.
+type filePart struct {
+	filename        string
+	header, trailer []byte
+	// size is the length of the whole body.
+	size int64
+}
+
+// filePartBody is an opened filePart, closing its file once sent.
+type filePartBody struct {
+	io.Reader
+	part *filePart
+	file *os.File
+}
+
+func (f *filePartBody) Close() error {
+	return f.file.Close()
+}
+
+func (p *filePart) open() (*filePartBody, error) {
+	file, err := os.Open(p.filename)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", i.token)
+	return &filePartBody{
+		Reader: io.MultiReader(bytes.NewReader(p.header), file, bytes.NewReader(p.trailer)),
+		part:   p,
+		file:   file,
+	}, nil
+}
+
+func (i *Insider) request(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if i.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+i.apiKey)
+	} else {
+		req.Header.Set("Authorization", i.token)
+	}
 	return req, nil
 }
 
-func auhenticate(email, password string) (string, error) {
+func (i *Insider) auhenticate(ctx context.Context, email, password string) (string, error) {
 	data := map[string]string{
 		"email":    email,
 		"password": password,
@@ -218,13 +680,13 @@ func auhenticate(email, password string) (string, error) {
 		return "", err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/api/auth", SastURL), bytes.NewBuffer(b))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/api/auth", i.sastURL), bytes.NewBuffer(b))
 	if err != nil {
 		return "", err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := i.do(req)
 	if err != nil {
 		return "", err
 	}
@@ -236,7 +698,15 @@ func auhenticate(email, password string) (string, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("status code: %d\n%s", resp.StatusCode, string(body))
+		// Never echo the password back, even if the backend includes it in the response.
+		msg := strings.Replace(statusError(resp.StatusCode, body).Error(), password, "********", -1)
+		switch resp.StatusCode {
+		case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+			return "", fmt.Errorf("%w: %s", ErrAuthFailed, msg)
+		}
+		// Other statuses, like a 5xx once the retries are exhausted, are
+		// backend failures rather than wrong credentials.
+		return "", errors.New(msg)
 	}
 
 	response := make(map[string]interface{})
@@ -246,8 +716,19 @@ func auhenticate(email, password string) (string, error) {
 
 	token, ok := response["token"]
 	if !ok {
-		return "", fmt.Errorf("not found token in response: %s", string(body))
+		return "", fmt.Errorf("%w: not found token in response: %s", ErrAuthFailed, strings.Replace(string(body), password, "********", -1))
 	}
 
 	return token.(string), nil
 }
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
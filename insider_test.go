@@ -0,0 +1,165 @@
+package insiderci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthenticateErrors(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"message":"refused for secret"}`)
+		}))
+		_, err := New(context.Background(), "user@example.com", "secret", "", 1, WithAPIURL(server.URL), WithRetry(0, 0))
+		server.Close()
+		if err == nil {
+			t.Fatalf("status %d: no error", status)
+		}
+		credentials := status < http.StatusInternalServerError
+		if errors.Is(err, ErrAuthFailed) != credentials {
+			t.Errorf("status %d: errors.Is(%v, ErrAuthFailed) = %v, want %v", status, err, !credentials, credentials)
+		}
+		if strings.Contains(err.Error(), "secret") {
+			t.Errorf("status %d: password in error %q", status, err)
+		}
+	}
+}
+
+func TestUploadBackendMessage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"message":"invalid component"}`)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	zip, err := ZipDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(zip)
+
+	insider, err := New(context.Background(), "", "", zip, 7, WithAPIURL(server.URL), WithToken("token"),
+		WithRetry(0, 0), WithProgress(ioutil.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = insider.Start(context.Background())
+	if !errors.Is(err, ErrUpload) {
+		t.Errorf("errors.Is(%v, ErrUpload) = false", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "status code 400: invalid component") {
+		t.Errorf("error = %v, want the message of the backend", err)
+	}
+}
+
+// pollServer answers the polls of analysis 5 of component 7 with responses,
+// repeating the last one, and counts the polls.
+func pollServer(responses ...string) (*httptest.Server, *int) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := responses[len(responses)-1]
+		if polls < len(responses) {
+			response = responses[polls]
+		}
+		polls++
+		fmt.Fprint(w, response)
+	}))
+	return server, &polls
+}
+
+func TestEmptyResults(t *testing.T) {
+	const (
+		pending  = `{"id":5,"status":2,"vulnerabilities":[]}`
+		clean    = `{"id":5,"status":2,"securityScore":"100","vulnerabilities":[]}`
+		findings = `{"id":5,"status":2,"securityScore":"80","vulnerabilities":[{"vul_id":"V1"}]}`
+	)
+	tests := []struct {
+		name            string
+		responses       []string
+		polls           int
+		vulnerabilities int
+		scoreMissing    bool
+	}{
+		{"complete without findings", []string{clean}, 1, 0, false},
+		{"still processing", []string{pending, pending, findings}, 3, 1, false},
+		{"never completed", []string{pending}, emptyResultPolls + 1, 0, true},
+	}
+	for _, test := range tests {
+		server, polls := pollServer(test.responses...)
+		insider, err := New(context.Background(), "", "", "", 7, WithAPIURL(server.URL), WithToken("token"),
+			WithRetry(0, 0), WithPollInterval(time.Millisecond), WithProgress(ioutil.Discard))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sast, err := insider.Resume(context.Background(), 5)
+		server.Close()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if *polls != test.polls {
+			t.Errorf("%s: polled %d times, want %d", test.name, *polls, test.polls)
+		}
+		if len(sast.SastVulnerabilities) != test.vulnerabilities || sast.ScoreMissing != test.scoreMissing {
+			t.Errorf("%s: got %d vulnerabilities, score missing %v, want %d, %v", test.name,
+				len(sast.SastVulnerabilities), sast.ScoreMissing, test.vulnerabilities, test.scoreMissing)
+		}
+	}
+}
+
+func TestStreamChecksum(t *testing.T) {
+	const content = "stream content"
+	for _, early := range []bool{false, true} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !early {
+				ioutil.ReadAll(r.Body)
+			}
+			fmt.Fprint(w, `{"sastCreated":{"id":5}}`)
+		}))
+		stream := func(w io.Writer) error {
+			if early {
+				// Write past what the server buffers, so it answers first.
+				for n := 0; n < 1<<12; n++ {
+					if _, err := io.WriteString(w, strings.Repeat(content, 256)); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			_, err := io.WriteString(w, content)
+			return err
+		}
+		insider, err := New(context.Background(), "", "", "package.zip", 7, WithAPIURL(server.URL), WithToken("token"),
+			WithRetry(0, 0), WithProgress(ioutil.Discard), WithPackageStream(stream))
+		if err != nil {
+			t.Fatal(err)
+		}
+		insider.Upload(context.Background())
+		server.Close()
+		want := ""
+		if !early {
+			sum := sha256.Sum256([]byte(content))
+			want = hex.EncodeToString(sum[:])
+		}
+		if got := insider.Checksum(); got != want {
+			t.Errorf("early answer %v: Checksum() = %q, want %q", early, got, want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package insiderci
+
+import "strconv"
+
+// File returns the source file of the vulnerability: its first affected file
+// or, when the backend sends none, its class.
+func (v SastVulnerability) File() string {
+	if len(v.AffectedFiles) > 0 && v.AffectedFiles[0] != "" {
+		return v.AffectedFiles[0]
+	}
+	return v.Class
+}
+
+// Location returns File followed by the line, when known, as in
+// src/Main.java:42.
+func (v SastVulnerability) Location() string {
+	file := v.File()
+	if file == "" || v.Line <= 0 {
+		return file
+	}
+	return file + ":" + strconv.Itoa(v.Line)
+}
@@ -0,0 +1,24 @@
+package insiderci
+
+// Logger receives structured events: a message followed by alternating keys
+// and values, as taken by the Info method of *slog.Logger, which can be given
+// to WithLogger as is.
+type Logger interface {
+	Info(msg string, args ...interface{})
+}
+
+// WithLogger sends the events of the login, the upload, every status check and
+// the end of the analysis to logger, with their durations. By default events
+// are discarded; the progress messages of WithProgress are not affected.
+func WithLogger(logger Logger) Option {
+	return func(i *Insider) {
+		if logger == nil {
+			logger = nopLogger{}
+		}
+		i.events = logger
+	}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Info(msg string, args ...interface{}) {}
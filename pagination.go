@@ -0,0 +1,96 @@
+package insiderci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// fetchPages appends the vulnerabilities of the pages following the results
+// response to sast. The backend documents no pagination of its own, so only
+// the standard Link header with rel="next" (RFC 8288) is followed, and only
+// to the host of the API, as the request carries the token.
+func (i *Insider) fetchPages(ctx context.Context, sast *Sast, header http.Header, base *url.URL) error {
+	visited := map[string]bool{base.String(): true}
+	for {
+		link := nextLink(header)
+		if link == "" {
+			return nil
+		}
+
+		next, err := base.Parse(link)
+		if err != nil {
+			return fmt.Errorf("invalid next page %q: %w", link, err)
+		}
+		if next.Scheme != base.Scheme || next.Host != base.Host {
+			return fmt.Errorf("results page links to %s, outside of the API %s://%s", next.Redacted(), base.Scheme, base.Host)
+		}
+		if visited[next.String()] {
+			return fmt.Errorf("results page %s links to a page already fetched", next)
+		}
+		visited[next.String()] = true
+
+		var body []byte
+		if body, header, err = i.fetchPage(ctx, next.String()); err != nil {
+			return err
+		}
+		var res Sast
+		if err := json.Unmarshal(body, &res); err != nil {
+			return err
+		}
+		sast.SastVulnerabilities = append(sast.SastVulnerabilities, res.SastVulnerabilities...)
+		sast.SastDras = append(sast.SastDras, res.SastDras...)
+	}
+}
+
+// nextLink returns the target of the Link header with rel="next", if any.
+func nextLink(header http.Header) string {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			params := strings.Split(link, ";")
+			target := strings.TrimSpace(params[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range params[1:] {
+				name, arg := param, ""
+				if eq := strings.Index(param, "="); eq >= 0 {
+					name, arg = param[:eq], param[eq+1:]
+				}
+				if !strings.EqualFold(strings.TrimSpace(name), "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(arg), `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func (i *Insider) fetchPage(ctx context.Context, url string) ([]byte, http.Header, error) {
+	req, err := i.request(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := i.do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, statusError(resp.StatusCode, b)
+	}
+	return b, resp.Header, nil
+}
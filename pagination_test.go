@@ -0,0 +1,95 @@
+package insiderci
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resultsServer serves the results of analysis 5 of component 7 in pages,
+// each page i linking to next(i) when it is not empty.
+func resultsServer(t *testing.T, pages int, next func(page int) string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/sast/5/component/7/ci" {
+			t.Errorf("unexpected request %s", r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "token" {
+			t.Errorf("request without the token: %q", r.Header.Get("Authorization"))
+		}
+		page := 1
+		fmt.Sscan(r.URL.Query().Get("page"), &page)
+		if link := next(page); page < pages && link != "" {
+			w.Header().Add("Link", `<https://docs.example.com>; rel="help"`)
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next last"`, link))
+		}
+		fmt.Fprintf(w, `{"id":5,"status":%d,"securityScore":"60","vulnerabilities":[{"vul_id":"V%d-1"},{"vul_id":"V%d-2"}]}`, StatusFinished, page, page)
+	}))
+}
+
+func resume(t *testing.T, url string) (*Sast, error) {
+	t.Helper()
+	insider, err := New(context.Background(), "", "", "", 7, WithAPIURL(url), WithToken("token"),
+		WithRetry(0, 0), WithPollInterval(time.Millisecond), WithProgress(ioutil.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return insider.Resume(context.Background(), 5)
+}
+
+func TestResultsPages(t *testing.T) {
+	server := resultsServer(t, 3, func(page int) string {
+		return fmt.Sprintf("/api/sast/5/component/7/ci?page=%d", page+1)
+	})
+	defer server.Close()
+
+	sast, err := resume(t, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, v := range sast.SastVulnerabilities {
+		ids = append(ids, v.VulID)
+	}
+	if got, want := strings.Join(ids, " "), "V1-1 V1-2 V2-1 V2-2 V3-1 V3-2"; got != want {
+		t.Errorf("vulnerabilities = %s, want %s", got, want)
+	}
+}
+
+func TestResultsPagesOutsideAPI(t *testing.T) {
+	var leaked int32
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&leaked, 1)
+	}))
+	defer other.Close()
+	server := resultsServer(t, 2, func(page int) string {
+		return other.URL + "/api/sast/5/component/7/ci?page=2"
+	})
+	defer server.Close()
+
+	_, err := resume(t, server.URL)
+	if err == nil || !strings.Contains(err.Error(), "outside of the API") {
+		t.Errorf("error = %v, want a link outside of the API", err)
+	}
+	if n := atomic.LoadInt32(&leaked); n > 0 {
+		t.Errorf("%d requests sent to the other host", n)
+	}
+}
+
+func TestResultsPageLoop(t *testing.T) {
+	server := resultsServer(t, 3, func(page int) string {
+		return "/api/sast/5/component/7/ci?page=1"
+	})
+	defer server.Close()
+
+	if _, err := resume(t, server.URL); err == nil || !strings.Contains(err.Error(), "already fetched") {
+		t.Errorf("error = %v, want a page already fetched", err)
+	}
+}
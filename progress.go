@@ -0,0 +1,52 @@
+package insiderci
+
+import (
+	"io"
+	"log"
+	"time"
+)
+
+const uploadProgressInterval = 2 * time.Second
+
+// progressReader logs how much of an upload was read, at most every
+// uploadProgressInterval. Uploads done within the interval are not reported.
+type progressReader struct {
+	r      io.Reader
+	logger *log.Logger
+	// total is the size of the upload, or 0 when unknown, as for streams.
+	total    int64
+	n        int64
+	reported time.Time
+	logged   bool
+}
+
+func newProgressReader(r io.Reader, total int64, logger *log.Logger) *progressReader {
+	return &progressReader{r: r, logger: logger, total: total, reported: time.Now()}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	done := err == io.EOF
+	if time.Since(p.reported) >= uploadProgressInterval || (done && p.logged) {
+		p.reported = time.Now()
+		p.logged = true
+		p.log()
+	}
+	return n, err
+}
+
+func (p *progressReader) log() {
+	if p.total <= 0 {
+		p.logger.Printf("Uploading: %s sent", FormatSize(p.n))
+		return
+	}
+	p.logger.Printf("Uploading: %d%% (%s of %s)", p.n*100/p.total, FormatSize(p.n), FormatSize(p.total))
+}
+
+func (p *progressReader) Close() error {
+	if c, ok := p.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package insiderci
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Ranks emitted by the backend in SastVulnerability.Rank, from the most to
+// the least severe. The backend is not consistent about case, so ranks should
+// always be compared through NormalizeRank.
+const (
+	RankCritical = "critical"
+	RankHigh     = "high"
+	RankMedium   = "medium"
+	RankLow      = "low"
+	RankInfo     = "info"
+)
+
+var Ranks = []string{RankCritical, RankHigh, RankMedium, RankLow, RankInfo}
+
+func NormalizeRank(rank string) string {
+	return strings.ToLower(strings.TrimSpace(rank))
+}
+
+// ParseRanks parses a comma separated list of ranks, such as "critical,high".
+func ParseRanks(list string) ([]string, error) {
+	var ranks []string
+	for _, rank := range strings.Split(list, ",") {
+		rank = NormalizeRank(rank)
+		if rank == "" {
+			continue
+		}
+		if !validRank(rank) {
+			return nil, fmt.Errorf("unknown rank %q: must be one of %s", rank, strings.Join(Ranks, ", "))
+		}
+		ranks = append(ranks, rank)
+	}
+	return ranks, nil
+}
+
+func validRank(rank string) bool {
+	for _, r := range Ranks {
+		if r == rank {
+			return true
+		}
+	}
+	return false
+}
+
+// Severity orders ranks so that more severe ranks compare greater. Unknown
+// ranks have severity 0.
+func Severity(rank string) int {
+	rank = NormalizeRank(rank)
+	for i, r := range Ranks {
+		if r == rank {
+			return len(Ranks) - i
+		}
+	}
+	return 0
+}
+
+// ParseCvss parses a CVSS score, which may use a decimal comma or be
+// followed by its vector, as in "7.5 (AV:N/AC:L)". It reports false for
+// empty or non numeric values such as "n/a".
+func ParseCvss(cvss string) (float64, bool) {
+	fields := strings.Fields(cvss)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	score, err := strconv.ParseFloat(strings.Replace(fields[0], ",", ".", 1), 64)
+	if err != nil {
+		return 0, false
+	}
+	return score, true
+}
+
+// SortVulnerabilities sorts from the most to the least severe rank and, within
+// a rank, by descending CVSS, with unparsable CVSS scores last.
+func SortVulnerabilities(vulnerabilities []SastVulnerability) {
+	sort.SliceStable(vulnerabilities, func(i, j int) bool {
+		a, b := vulnerabilities[i], vulnerabilities[j]
+		if sa, sb := Severity(a.Rank), Severity(b.Rank); sa != sb {
+			return sa > sb
+		}
+		ca, oka := ParseCvss(a.Cvss)
+		cb, okb := ParseCvss(b.Cvss)
+		if oka != okb {
+			return oka
+		}
+		return ca > cb
+	})
+}
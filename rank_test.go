@@ -0,0 +1,38 @@
+package insiderci
+
+import "testing"
+
+func TestParseCvss(t *testing.T) {
+	tests := []struct {
+		cvss  string
+		score float64
+		ok    bool
+	}{
+		{"7.5", 7.5, true},
+		{" 9.8 ", 9.8, true},
+		{"9.8 (AV:N/AC:L)", 9.8, true},
+		{"5,0", 5, true},
+		{"", 0, false},
+		{"n/a", 0, false},
+	}
+	for _, test := range tests {
+		score, ok := ParseCvss(test.cvss)
+		if score != test.score || ok != test.ok {
+			t.Errorf("ParseCvss(%q) = %v, %v, want %v, %v", test.cvss, score, ok, test.score, test.ok)
+		}
+	}
+}
+
+func TestSortVulnerabilitiesWithVector(t *testing.T) {
+	vulns := []SastVulnerability{
+		{Rank: RankHigh, Cvss: "5.0"},
+		{Rank: RankHigh, Cvss: "9.8 (AV:N)"},
+		{Rank: RankHigh, Cvss: "n/a"},
+	}
+	SortVulnerabilities(vulns)
+	for i, want := range []string{"9.8 (AV:N)", "5.0", "n/a"} {
+		if vulns[i].Cvss != want {
+			t.Errorf("vulnerability %d has CVSS %q, want %q", i, vulns[i].Cvss, want)
+		}
+	}
+}
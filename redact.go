@@ -0,0 +1,60 @@
+package insiderci
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strings"
+)
+
+// Redactor replaces the directories of the paths in results by a short hash,
+// keeping the file names so that findings stay distinguishable. The same
+// directory always gets the same hash, and Mapping reverses them.
+type Redactor struct {
+	dirs map[string]string
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{dirs: make(map[string]string)}
+}
+
+// Path redacts the directory of the slash separated path p, as in
+// src/main/App.java to 3f1c9a2b/App.java. Paths without a directory are kept.
+func (r *Redactor) Path(p string) string {
+	dir, file := path.Split(p)
+	dir = strings.TrimSuffix(dir, "/")
+	if dir == "" {
+		return p
+	}
+	sum := sha256.Sum256([]byte(dir))
+	hash := hex.EncodeToString(sum[:4])
+	r.dirs[hash] = dir
+	return hash + "/" + file
+}
+
+// Sast redacts the classes and affected files of the vulnerabilities and the
+// files of the DRA of sast, and sets Redacted. Raw is left as received.
+func (r *Redactor) Sast(sast *Sast) {
+	sast.Redacted = true
+	r.Vulnerabilities(sast.SastVulnerabilities)
+	for i := range sast.SastDras {
+		sast.SastDras[i].File = r.Path(sast.SastDras[i].File)
+	}
+}
+
+func (r *Redactor) Vulnerabilities(vulnerabilities []SastVulnerability) {
+	for i := range vulnerabilities {
+		v := &vulnerabilities[i]
+		v.Class = r.Path(v.Class)
+		files := make([]string, len(v.AffectedFiles))
+		for j, file := range v.AffectedFiles {
+			files[j] = r.Path(file)
+		}
+		v.AffectedFiles = files
+	}
+}
+
+// Mapping returns the directory of every hash given by Path.
+func (r *Redactor) Mapping() map[string]string {
+	return r.dirs
+}
@@ -0,0 +1,138 @@
+package insiderci
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultRetryDelay = time.Second
+	// maxRetryDelay caps the exponential backoff and the Retry-After of a
+	// 429 response, so that retries do not wait for hours, or overflow.
+	maxRetryDelay = 30 * time.Second
+)
+
+// WithRetry retries requests failing with a 5xx or 429 status, a connection
+// reset or a timeout up to maxRetries times, waiting an exponentially growing,
+// jittered delay starting at baseDelay between attempts, or the Retry-After of
+// a 429 response, up to 30s.
+func WithRetry(maxRetries int, baseDelay time.Duration) Option {
+	return func(i *Insider) {
+		i.maxRetries = maxRetries
+		i.retryDelay = baseDelay
+	}
+}
+
+// WithUploadRetry retries the upload of the package up to maxRetries times,
+// instead of the maxRetries of WithRetry, so that a large upload failing on a
+// flaky network can be retried more, or less, than the other requests.
+func WithUploadRetry(maxRetries int) Option {
+	return func(i *Insider) {
+		i.uploadRetries = maxRetries
+	}
+}
+
+func (i *Insider) do(req *http.Request) (*http.Response, error) {
+	return i.doRetry(req, i.maxRetries)
+}
+
+// doRetry sends req, retrying it up to maxRetries times.
+func (i *Insider) doRetry(req *http.Request, maxRetries int) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		i.debugRequest(req, attempt)
+		started := time.Now()
+		resp, err := i.client.Do(req)
+		i.debugResponse(req, resp, err, time.Since(started))
+		// Bodies that can't be replayed, like a streamed upload, are sent only once.
+		replayable := req.Body == nil || req.GetBody != nil
+		if attempt >= maxRetries || !replayable || !retryable(resp, err) {
+			return resp, err
+		}
+
+		var reason string
+		delay := i.backoff(attempt)
+		if resp != nil {
+			reason = "status " + resp.Status
+			if after, ok := retryAfter(resp); ok {
+				delay = after
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			reason = err.Error()
+		}
+		i.logger.Printf("Request %s %s failed with %s, retrying in %s", req.Method, req.URL.Path, reason, delay)
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (i *Insider) backoff(attempt int) time.Duration {
+	delay := i.retryDelay
+	if delay <= 0 {
+		return 0
+	}
+	for n := 0; n < attempt && delay < maxRetryDelay; n++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	half := delay / 2
+	return half + time.Duration(i.random.Int63n(int64(half)+1))
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return true
+		}
+		return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// retryAfter parses the Retry-After header of a 429 response, given in seconds
+// or as an HTTP date, capped at maxRetryDelay.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if resp.StatusCode != http.StatusTooManyRequests || value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		if seconds > int(maxRetryDelay/time.Second) {
+			return maxRetryDelay, true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	delay := time.Until(date)
+	switch {
+	case delay > maxRetryDelay:
+		return maxRetryDelay, true
+	case delay > 0:
+		return delay, true
+	}
+	return 0, true
+}
@@ -0,0 +1,40 @@
+package insiderci
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoffIsCapped(t *testing.T) {
+	i := newInsider("", 0, []Option{WithRetry(100, time.Second)})
+	for _, attempt := range []int{0, 1, 5, 34, 63, 64, 100} {
+		delay := i.backoff(attempt)
+		if delay <= 0 || delay > maxRetryDelay {
+			t.Errorf("backoff(%d) = %v, want in (0, %v]", attempt, delay, maxRetryDelay)
+		}
+	}
+	if delay := i.backoff(100); delay < maxRetryDelay/2 {
+		t.Errorf("backoff(100) = %v, want at least %v", delay, maxRetryDelay/2)
+	}
+}
+
+func TestRetryAfterIsCapped(t *testing.T) {
+	for _, test := range []struct {
+		value string
+		want  time.Duration
+	}{
+		{"5", 5 * time.Second},
+		{"30", maxRetryDelay},
+		{"3600", maxRetryDelay},
+		{"99999999999999", maxRetryDelay},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), maxRetryDelay},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	} {
+		resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {test.value}}}
+		delay, ok := retryAfter(resp)
+		if !ok || delay != test.want {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, true", test.value, delay, ok, test.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package insiderci
+
+import "sort"
+
+// rankCVSS is the CVSS weighing vulnerabilities without a numeric one in
+// FileRisks, the lowest score of their rank in CVSS v3.
+var rankCVSS = map[string]float64{
+	"critical": 9,
+	"high":     7,
+	"medium":   4,
+	"low":      0.1,
+}
+
+// FileRisk is the risk of a file: the sum of the CVSS scores of its
+// vulnerabilities.
+type FileRisk struct {
+	File            string  `json:"file"`
+	Vulnerabilities int     `json:"vulnerabilities"`
+	Risk            float64 `json:"risk"`
+}
+
+// FileRisks returns the n files with the highest risk, the riskiest first, or
+// every file when n is 0. Baselined vulnerabilities are not counted.
+func FileRisks(vulnerabilities []SastVulnerability, n int) []FileRisk {
+	var risks []FileRisk
+	index := make(map[string]int)
+	for _, v := range vulnerabilities {
+		if v.Baselined {
+			continue
+		}
+		file := v.File()
+		i, ok := index[file]
+		if !ok {
+			i = len(risks)
+			index[file] = i
+			risks = append(risks, FileRisk{File: file})
+		}
+		cvss, ok := ParseCvss(v.Cvss)
+		if !ok {
+			cvss = rankCVSS[NormalizeRank(v.Rank)]
+		}
+		risks[i].Vulnerabilities++
+		risks[i].Risk += cvss
+	}
+	sort.SliceStable(risks, func(i, j int) bool {
+		if risks[i].Risk != risks[j].Risk {
+			return risks[i].Risk > risks[j].Risk
+		}
+		return risks[i].Vulnerabilities > risks[j].Vulnerabilities
+	})
+	if n > 0 && len(risks) > n {
+		risks = risks[:n]
+	}
+	return risks
+}
@@ -0,0 +1,34 @@
+package insiderci
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Score is the security score of an analysis, from 0 to 100. The backend
+// sends it either as a number or as a string holding one; both decode.
+type Score float64
+
+func (s *Score) UnmarshalJSON(data []byte) error {
+	var n float64
+	if err := json.Unmarshal(data, &n); err == nil {
+		*s = Score(n)
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("invalid security score %s", data)
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil {
+		return fmt.Errorf("invalid security score %q", str)
+	}
+	*s = Score(n)
+	return nil
+}
+
+func (s Score) String() string {
+	return strconv.FormatFloat(float64(s), 'f', -1, 64)
+}
@@ -0,0 +1,180 @@
+package insiderci
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	ScoreGreater        = "gt"
+	ScoreGreaterOrEqual = "gte"
+)
+
+// Policy decides whether an analysis fails. Without Score, FailOn, MinCVSS or
+// MaxCounts any vulnerability fails the analysis.
+type Policy struct {
+	// Score is the minimum security score, compared with ScoreOperator:
+	// lower scores fail the analysis, as a higher score is better.
+	Score         int
+	ScoreOperator string
+	// FailOn fails the analysis when a vulnerability has one of these ranks.
+	FailOn []string
+	// MinCVSS, when positive, fails the analysis when a vulnerability has a
+	// CVSS score of at least MinCVSS. Vulnerabilities without a numeric CVSS
+	// are not counted.
+	MinCVSS float64
+	// MaxCounts fails the analysis when a rank has more vulnerabilities than
+	// its maximum. Ranks without a maximum are not limited.
+	MaxCounts map[string]int
+	// RequireScore fails the analysis when the results have no security
+	// score, which may mean the backend did not analyze anything.
+	RequireScore bool
+	// FailOnAny fails the analysis on any vulnerability, including the
+	// baselined ones, whatever their rank or the score.
+	FailOnAny bool
+}
+
+func (p Policy) Validate() error {
+	switch p.ScoreOperator {
+	case "", ScoreGreater, ScoreGreaterOrEqual:
+	default:
+		return fmt.Errorf("invalid score operator %q: must be %s or %s", p.ScoreOperator, ScoreGreater, ScoreGreaterOrEqual)
+	}
+	if p.Score < 0 || p.Score > 100 {
+		return fmt.Errorf("invalid score %d: must be between 0 and 100", p.Score)
+	}
+	if p.MinCVSS < 0 || p.MinCVSS > 10 {
+		return fmt.Errorf("invalid minimum CVSS %g: must be between 0 and 10", p.MinCVSS)
+	}
+	for _, rank := range p.FailOn {
+		if !validRank(NormalizeRank(rank)) {
+			return fmt.Errorf("unknown rank %q: must be one of %s", rank, strings.Join(Ranks, ", "))
+		}
+	}
+	for rank, max := range p.MaxCounts {
+		if !validRank(NormalizeRank(rank)) {
+			return fmt.Errorf("unknown rank %q: must be one of %s", rank, strings.Join(Ranks, ", "))
+		}
+		if max < 0 {
+			return fmt.Errorf("invalid maximum of %s vulnerabilities %d: can't be negative", rank, max)
+		}
+	}
+	return nil
+}
+
+// Summary counts the vulnerabilities by rank. Baselined vulnerabilities are
+// only counted in Baselined and never fail the analysis, as the ones removed by
+// a ClassFilter, counted in Filtered.
+type Summary struct {
+	Score        Score          `json:"score"`
+	ScoreMissing bool           `json:"scoreMissing,omitempty"`
+	Total        int            `json:"total"`
+	Counts       map[string]int `json:"counts"`
+	Baselined    int            `json:"baselined,omitempty"`
+	Filtered     int            `json:"filtered,omitempty"`
+	// Clean reports an analysis without any vulnerability, baselined or not.
+	Clean bool `json:"clean"`
+	// AboveCVSS counts the vulnerabilities with a CVSS score of at least the
+	// MinCVSS of the policy.
+	AboveCVSS int    `json:"aboveCvss,omitempty"`
+	Failed    bool   `json:"failed"`
+	Reason    string `json:"reason,omitempty"`
+	// Timings is how long each phase of the analysis took, when it was run
+	// by Start rather than loaded from a file.
+	Timings *Timings `json:"timings,omitempty"`
+}
+
+// Line formats the summary as space separated key=value pairs, with a count
+// for every known rank, e.g. "score=82 critical=1 high=3 medium=0 low=5
+// info=0 total=9".
+func (s Summary) Line() string {
+	fields := []string{fmt.Sprintf("score=%s", s.Score)}
+	for _, rank := range Ranks {
+		fields = append(fields, fmt.Sprintf("%s=%d", rank, s.Counts[rank]))
+	}
+	fields = append(fields, fmt.Sprintf("total=%d", s.Total))
+	if s.Baselined > 0 {
+		fields = append(fields, fmt.Sprintf("baselined=%d", s.Baselined))
+	}
+	if s.Filtered > 0 {
+		fields = append(fields, fmt.Sprintf("filtered=%d", s.Filtered))
+	}
+	return strings.Join(fields, " ")
+}
+
+func Summarize(sast *Sast, policy Policy) Summary {
+	summary := Summary{
+		Score:        sast.SecurityScore,
+		Counts:       make(map[string]int),
+		Filtered:     sast.Filtered,
+		ScoreMissing: sast.ScoreMissing,
+	}
+	for _, v := range sast.SastVulnerabilities {
+		if v.Baselined {
+			summary.Baselined++
+			continue
+		}
+		summary.Total++
+		summary.Counts[NormalizeRank(v.Rank)]++
+		if cvss, ok := ParseCvss(v.Cvss); ok && policy.MinCVSS > 0 && cvss >= policy.MinCVSS {
+			summary.AboveCVSS++
+		}
+	}
+	summary.Clean = summary.Total+summary.Baselined == 0
+	if sast.Timings.Total() > 0 {
+		timings := sast.Timings
+		summary.Timings = &timings
+	}
+	summary.Failed, summary.Reason = policy.evaluate(summary)
+	return summary
+}
+
+func (p Policy) evaluate(summary Summary) (bool, string) {
+	if p.RequireScore && summary.ScoreMissing {
+		return true, "No security score in the results"
+	}
+	if p.FailOnAny && !summary.Clean {
+		return true, fmt.Sprintf("Found %d vulnerabilities", summary.Total+summary.Baselined)
+	}
+	if summary.Total == 0 {
+		return false, ""
+	}
+
+	found := 0
+	for _, rank := range p.FailOn {
+		found += summary.Counts[NormalizeRank(rank)]
+	}
+	if found > 0 {
+		return true, fmt.Sprintf("Found %d vulnerabilities ranked %s", found, strings.Join(p.FailOn, ", "))
+	}
+	if summary.AboveCVSS > 0 {
+		return true, fmt.Sprintf("Found %d vulnerabilities with CVSS %g or higher", summary.AboveCVSS, p.MinCVSS)
+	}
+	// Ranks are checked from the most severe, for a stable reason.
+	for _, rank := range Ranks {
+		for name, max := range p.MaxCounts {
+			if n := summary.Counts[rank]; NormalizeRank(name) == rank && n > max {
+				return true, fmt.Sprintf("Found %d %s vulnerabilities, more than the %d allowed", n, rank, max)
+			}
+		}
+	}
+
+	if p.Score == 0 {
+		if len(p.FailOn) > 0 || p.MinCVSS > 0 || len(p.MaxCounts) > 0 {
+			return false, ""
+		}
+		return true, fmt.Sprintf("Found %d vulnerabilities", summary.Total)
+	}
+
+	switch p.ScoreOperator {
+	case ScoreGreaterOrEqual:
+		if float64(summary.Score) < float64(p.Score) {
+			return true, fmt.Sprintf("Score %s lower than %d", summary.Score, p.Score)
+		}
+	default:
+		if float64(summary.Score) <= float64(p.Score) {
+			return true, fmt.Sprintf("Score %s not greater than %d", summary.Score, p.Score)
+		}
+	}
+	return false, ""
+}
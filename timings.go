@@ -0,0 +1,42 @@
+package insiderci
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Timings is how long each phase of an analysis took, measured with the
+// monotonic clock. The backend does not report when a queued analysis starts
+// running, so Scan includes the wait in its queue.
+type Timings struct {
+	// Zip is set by the callers zipping a directory before Start. When the zip
+	// is streamed with WithPackageStream, it is part of Upload.
+	Zip      time.Duration
+	Upload   time.Duration
+	Scan     time.Duration
+	Download time.Duration
+}
+
+// Total returns the sum of every phase.
+func (t Timings) Total() time.Duration {
+	return t.Zip + t.Upload + t.Scan + t.Download
+}
+
+func (t Timings) String() string {
+	round := func(d time.Duration) time.Duration { return d.Round(time.Millisecond) }
+	return fmt.Sprintf("zip %s, upload %s, scan %s, download %s, total %s",
+		round(t.Zip), round(t.Upload), round(t.Scan), round(t.Download), round(t.Total()))
+}
+
+// MarshalJSON encodes every phase, and the total, in seconds.
+func (t Timings) MarshalJSON() ([]byte, error) {
+	seconds := func(d time.Duration) float64 { return d.Round(time.Millisecond).Seconds() }
+	return json.Marshal(struct {
+		Zip      float64 `json:"zip"`
+		Upload   float64 `json:"upload"`
+		Scan     float64 `json:"scan"`
+		Download float64 `json:"download"`
+		Total    float64 `json:"total"`
+	}{seconds(t.Zip), seconds(t.Upload), seconds(t.Scan), seconds(t.Download), seconds(t.Total())})
+}
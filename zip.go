@@ -0,0 +1,384 @@
+package insiderci
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrEmptyDirectory is returned when every file of the directory was ignored
+// or excluded; the backend rejects empty archives.
+var ErrEmptyDirectory = errors.New("no files to analyze")
+
+// sourceExtensions are the extensions of the source files the Insider
+// analyzes, used to warn about archives holding none of them.
+var sourceExtensions = map[string]bool{
+	".c": true, ".cc": true, ".cpp": true, ".cxx": true, ".h": true, ".hpp": true, ".m": true, ".mm": true,
+	".cs": true, ".cshtml": true, ".aspx": true, ".vb": true,
+	".java": true, ".jsp": true, ".kt": true, ".kts": true, ".scala": true, ".groovy": true,
+	".js": true, ".jsx": true, ".mjs": true, ".cjs": true, ".ts": true, ".tsx": true, ".vue": true,
+	".py": true, ".rb": true, ".erb": true, ".php": true, ".go": true, ".rs": true, ".dart": true,
+	".swift": true, ".pl": true, ".lua": true, ".sh": true, ".sql": true, ".html": true,
+}
+
+// SizeError is returned for archives larger than the limit of WithMaxSize.
+// Zipping stops as soon as the limit is exceeded, so Size is 0 when the size
+// of the whole archive is not known.
+type SizeError struct {
+	Size, Limit int64
+}
+
+func (e *SizeError) Error() string {
+	if e.Size == 0 {
+		return fmt.Sprintf("archive exceeds limit of %s", FormatSize(e.Limit))
+	}
+	return fmt.Sprintf("archive %s exceeds limit of %s", FormatSize(e.Size), FormatSize(e.Limit))
+}
+
+// archive holds the options of ZipDirectory.
+type archive struct {
+	excludes []string
+	level    int
+	// followSymlinks zips the targets of symbolic links that resolve inside
+	// the directory. Otherwise every link is skipped.
+	followSymlinks bool
+	// skipHidden leaves out the files and directories whose name starts
+	// with a dot.
+	skipHidden bool
+	// files, when not nil, holds the only names zipped.
+	files map[string]bool
+	// maxSize fails archives larger than it, when positive.
+	maxSize int64
+}
+
+// WithExclude leaves the files and directories matching patterns out of the
+// zip. Patterns are slash separated globs relative to the directory, where **
+// matches any number of directories, see ValidatePatterns.
+func WithExclude(patterns ...string) Option {
+	return func(i *Insider) {
+		i.archive.excludes = append(i.archive.excludes, patterns...)
+	}
+}
+
+// WithCompression sets the deflate level of the zip entries, from
+// flate.BestSpeed to flate.BestCompression. flate.NoCompression stores them
+// uncompressed. The default is flate.DefaultCompression.
+func WithCompression(level int) Option {
+	return func(i *Insider) {
+		i.archive.level = level
+	}
+}
+
+// WithFollowSymlinks zips the targets of the symbolic links that resolve
+// inside the directory, instead of skipping every link.
+func WithFollowSymlinks() Option {
+	return func(i *Insider) {
+		i.archive.followSymlinks = true
+	}
+}
+
+// WithSkipHidden leaves the hidden files and directories, whose name starts
+// with a dot, such as .github or .idea, out of the zip.
+func WithSkipHidden() Option {
+	return func(i *Insider) {
+		i.archive.skipHidden = true
+	}
+}
+
+// WithFiles only zips the given files, slash separated and relative to the
+// directory, such as the files changed by a pull request. The files must still
+// pass the ignore files and WithExclude; listed files that do not exist, like
+// deleted ones, are skipped.
+func WithFiles(names ...string) Option {
+	return func(i *Insider) {
+		if i.archive.files == nil {
+			i.archive.files = make(map[string]bool)
+		}
+		for _, name := range names {
+			i.archive.files[entryName(name, filepath.Separator)] = true
+		}
+	}
+}
+
+// WithMaxSize fails zipping with a *SizeError when the archive is larger than
+// size bytes.
+func WithMaxSize(size int64) Option {
+	return func(i *Insider) {
+		i.archive.maxSize = size
+	}
+}
+
+// ZipDirectory zips dir into a temporary file and returns its name; the
+// caller removes it once done. Files ignored by the .gitignore and
+// .insiderignore files of dir, the .git directory and the files given to
+// WithExclude are left out.
+func ZipDirectory(dir string, opts ...Option) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	file, err := ioutil.TempFile("", fmt.Sprintf("%s-*.zip", filepath.Base(abs)))
+	if err != nil {
+		return "", err
+	}
+	err = ZipTo(file, dir, opts...)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// ZipTo writes the zip of dir, as ZipDirectory does, to w. It can be given
+// to WithPackageStream to upload a directory without a temporary file.
+func ZipTo(w io.Writer, dir string, opts ...Option) error {
+	i := newInsider("", 0, opts)
+	return i.archive.zip(w, dir, i.logger)
+}
+
+// WalkDirectory calls fn for every file ZipDirectory would zip, with its slash
+// separated name relative to dir.
+func WalkDirectory(dir string, fn func(name string, info os.FileInfo) error, opts ...Option) error {
+	a := newInsider("", 0, opts).archive
+	if err := ValidatePatterns(a.excludes); err != nil {
+		return err
+	}
+	return a.walk(dir, func(file, name string, info os.FileInfo) error {
+		return fn(name, info)
+	})
+}
+
+// limitWriter writes to w until more than limit bytes are written, then fails
+// with a *SizeError, so that neither the zip nor a streamed upload go on.
+type limitWriter struct {
+	w     io.Writer
+	limit int64
+	n     int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.n+int64(len(p)) > l.limit {
+		return 0, &SizeError{Limit: l.limit}
+	}
+	n, err := l.w.Write(p)
+	l.n += int64(n)
+	return n, err
+}
+
+// zip writes the zip of dir to out, warning on logger when none of its files
+// is source code, as the analysis would then find nothing.
+func (a archive) zip(out io.Writer, dir string, logger *log.Logger) error {
+	if err := ValidatePatterns(a.excludes); err != nil {
+		return err
+	}
+	if a.maxSize > 0 {
+		out = &limitWriter{w: out, limit: a.maxSize}
+	}
+	writer := zip.NewWriter(out)
+	method := zip.Deflate
+	if a.level == flate.NoCompression {
+		method = zip.Store
+	} else {
+		writer.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, a.level)
+		})
+	}
+	files, sources := 0, 0
+
+	err := a.walk(dir, func(file, name string, info os.FileInfo) error {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		// The header keeps the permissions and modification time of the file.
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		header.Method = method
+		z, err := writer.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(z, f); err != nil {
+			return err
+		}
+		files++
+		if sourceExtensions[strings.ToLower(path.Ext(name))] {
+			sources++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if files == 0 {
+		return ErrEmptyDirectory
+	}
+	if sources == 0 {
+		logger.Printf("Warning: none of the %d files zipped is source code, check the ignore files and -exclude", files)
+	}
+	return writer.Close()
+}
+
+// walk calls fn for every file of dir not ignored by a .gitignore or
+// excluded, with its name relative to dir. Names are slash separated on every
+// OS, as zip entries must be.
+func (a archive) walk(dir string, fn func(file, name string, info os.FileInfo) error) error {
+	// The directory itself may be a link, which filepath.Walk would skip as
+	// any other; only the links below it are skipped or followed.
+	physical, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	w := &walker{archive: a, dir: physical, fn: fn, ignore: &gitignore{}, visited: make(map[string]bool)}
+	if a.followSymlinks {
+		root, err := realPath(physical)
+		if err != nil {
+			return err
+		}
+		w.root = root
+	}
+	return w.walk(physical, "")
+}
+
+type walker struct {
+	archive
+	dir string
+	// root is dir with its symbolic links resolved, which no followed link
+	// may point outside of.
+	root string
+	fn   func(file, name string, info os.FileInfo) error
+
+	ignore *gitignore
+	// visited holds the resolved directories already walked, so that links
+	// to a parent directory do not loop.
+	visited map[string]bool
+}
+
+// walk walks the directory physical, naming its files relative to the target
+// directory under prefix.
+func (w *walker) walk(physical, prefix string) error {
+	return filepath.Walk(physical, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(physical, file)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(prefix, rel)
+		name := entryName(path, filepath.Separator)
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !w.followSymlinks {
+				return nil
+			}
+			return w.symlink(file, path)
+		}
+		if info.IsDir() {
+			if path != "." && w.ignored(name, true) {
+				return filepath.SkipDir
+			}
+			if w.followSymlinks {
+				real, err := realPath(file)
+				if err != nil {
+					return err
+				}
+				w.visited[real] = true
+			}
+			return w.ignore.load(w.dir, path)
+		}
+		if w.ignored(name, false) || !w.selected(name) {
+			return nil
+		}
+		return w.fn(file, name, info)
+	})
+}
+
+// symlink follows the link file when it resolves inside the target directory.
+// Dangling links, links escaping the directory and links to a directory
+// already walked are skipped.
+func (w *walker) symlink(file, path string) error {
+	real, err := realPath(file)
+	if err != nil {
+		return nil
+	}
+	rel, err := filepath.Rel(w.root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return err
+	}
+
+	name := entryName(path, filepath.Separator)
+	if !info.IsDir() {
+		if w.ignored(name, false) || !w.selected(name) {
+			return nil
+		}
+		return w.fn(real, name, info)
+	}
+	if w.visited[real] || w.ignored(name, true) {
+		return nil
+	}
+	return w.walk(real, path)
+}
+
+// entryName returns the zip entry name of the relative file name, whose
+// directories are separated by separator: zip entries are slash separated on
+// every OS, and must not hold . or .. elements.
+func entryName(name string, separator byte) string {
+	if separator != '/' {
+		name = strings.Replace(name, string(separator), "/", -1)
+	}
+	return path.Clean(name)
+}
+
+func (w *walker) selected(name string) bool {
+	return w.files == nil || w.files[name]
+}
+
+func (w *walker) ignored(name string, isDir bool) bool {
+	if w.skipHidden && strings.HasPrefix(path.Base(name), ".") {
+		return true
+	}
+	return w.ignore.match(name, isDir) || excluded(name, w.excludes)
+}
+
+// FormatSize formats n bytes in the largest binary unit, as in 2.3 GiB.
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func realPath(file string) (string, error) {
+	real, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(real)
+}
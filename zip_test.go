@@ -0,0 +1,128 @@
+package insiderci
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// zipNames zips dir with opts and returns the names of its entries.
+func zipNames(t *testing.T, dir string, opts ...Option) []string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := ZipTo(&buf, dir, opts...); err != nil {
+		t.Fatalf("ZipTo(%s): %v", dir, err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func writeFiles(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, name := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte("package main\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestZipLinkedDirectory(t *testing.T) {
+	tmp := t.TempDir()
+	dir := filepath.Join(tmp, "src")
+	writeFiles(t, dir, "main.go", "pkg/util.go")
+	link := filepath.Join(tmp, "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	for _, opts := range [][]Option{nil, {WithFollowSymlinks()}} {
+		got := zipNames(t, link, opts...)
+		if want := []string{"main.go", "pkg/util.go"}; !equalStrings(got, want) {
+			t.Errorf("entries = %v, want %v", got, want)
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEntryName(t *testing.T) {
+	tests := []struct {
+		name      string
+		separator byte
+		want      string
+	}{
+		{`main.go`, '\\', "main.go"},
+		{`src\pkg\util.go`, '\\', "src/pkg/util.go"},
+		{`.\src\..\main.go`, '\\', "main.go"},
+		{`src\\pkg\util.go`, '\\', "src/pkg/util.go"},
+		{`src/pkg\util.go`, '\\', "src/pkg/util.go"},
+		{"src/pkg/util.go", '/', "src/pkg/util.go"},
+		{"./src//pkg/../main.go", '/', "src/main.go"},
+	}
+	for _, test := range tests {
+		if got := entryName(test.name, test.separator); got != test.want {
+			t.Errorf("entryName(%q, %q) = %q, want %q", test.name, test.separator, got, test.want)
+		}
+	}
+}
+
+func TestWithFilesNativeSeparators(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "main.go", "src/pkg/util.go", "src/other.go")
+	got := zipNames(t, dir, WithFiles(filepath.Join("src", "pkg", "util.go"), "."+string(filepath.Separator)+"main.go"))
+	if want := []string{"main.go", "src/pkg/util.go"}; !equalStrings(got, want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+}
+
+func TestZipStopsAtMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	random := make([]byte, 64<<10)
+	for i := range random {
+		random[i] = byte(i * 7919 >> 3)
+	}
+	for _, name := range []string{"a.go", "b.go", "c.go"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), random, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const limit = 16 << 10
+	var buf bytes.Buffer
+	err := ZipTo(&buf, dir, WithMaxSize(limit), WithCompression(flate.NoCompression))
+	var sizeErr *SizeError
+	if !errors.As(err, &sizeErr) || sizeErr.Limit != limit {
+		t.Fatalf("ZipTo error = %v, want a *SizeError of limit %d", err, limit)
+	}
+	if buf.Len() > limit {
+		t.Errorf("wrote %d bytes, more than the %d limit", buf.Len(), limit)
+	}
+}